@@ -0,0 +1,366 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/rpc"
+	"net/rpc/jsonrpc"
+	"sync"
+
+	"github.com/bovarysme/bmo/beemo"
+	"github.com/bovarysme/bmo/cpu"
+	"github.com/bovarysme/bmo/input"
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// Memory ranges can't go past the end of the address space.
+const addressSpaceSize = 0x10000
+
+// API exposes an emulator over JSON-RPC (version 1.0, one object per line),
+// as the "BMO" service, so that test suites written in any language can
+// drive it. Byte arrays are encoded in base64.
+type API struct {
+	// ROMPath is replaced by LoadROM.
+	options beemo.Options
+
+	// Held during each call
+	mutex sync.Mutex
+	// Nil until a ROM is loaded
+	bmo *beemo.BMO
+}
+
+// Empty is used by the methods without arguments or results.
+type Empty struct{}
+
+type LoadROMArgs struct {
+	Path string `json:"path"`
+}
+
+type CountArgs struct {
+	Count int `json:"count"`
+}
+
+type CyclesReply struct {
+	// Number of M-cycles run, which can exceed the count since whole
+	// instructions are executed
+	Cycles int `json:"cycles"`
+}
+
+type ButtonsArgs struct {
+	// Names of the buttons (right, left, up, down, a, b, select or start)
+	Buttons []string `json:"buttons"`
+}
+
+type ReadMemoryArgs struct {
+	Address uint16 `json:"address"`
+	Length  int    `json:"length"`
+}
+
+type WriteMemoryArgs struct {
+	Address uint16 `json:"address"`
+	Data    []byte `json:"data"`
+}
+
+type MemoryReply struct {
+	Data []byte `json:"data"`
+}
+
+type FramebufferReply struct {
+	Width  int `json:"width"`
+	Height int `json:"height"`
+	// RGB triplets, from the top left pixel
+	Pixels []byte `json:"pixels"`
+	// Same hash as the one printed when running headless
+	Hash string `json:"hash"`
+}
+
+type StateArgs struct {
+	Data []byte `json:"data"`
+}
+
+type StateReply struct {
+	Data []byte `json:"data"`
+}
+
+// NewAPI returns an API creating emulators with the given options, the ROM
+// being loaded right away if its path is set.
+func NewAPI(options beemo.Options) (*API, error) {
+	// The emulator only runs when asked to, without a window, keys or
+	// rewinding.
+	options.Headless = true
+	options.Uncapped = true
+	options.RewindInterval = 0
+
+	a := &API{options: options}
+
+	if options.ROMPath != "" {
+		bmo, err := beemo.NewBMO(options)
+		if err != nil {
+			return nil, err
+		}
+
+		a.bmo = bmo
+	}
+
+	return a, nil
+}
+
+// Serve accepts connections on an address and serves the API on each of
+// them. The API can read files and control the emulator without any
+// authentication, so it's only served on loopback addresses (127.0.0.1 if
+// the address has no host).
+func Serve(address string, a *API) error {
+	address, err := loopback(address)
+	if err != nil {
+		return err
+	}
+
+	server := rpc.NewServer()
+
+	err = server.RegisterName("BMO", a)
+	if err != nil {
+		return err
+	}
+
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return err
+	}
+	defer listener.Close()
+
+	log.Printf("Serving the JSON-RPC API on %s\n", listener.Addr())
+
+	for {
+		conn, err := listener.Accept()
+		if err != nil {
+			return err
+		}
+
+		go server.ServeCodec(jsonrpc.NewServerCodec(conn))
+	}
+}
+
+// loopback checks that an address is a loopback one, binding to 127.0.0.1
+// if it has no host.
+func loopback(address string) (string, error) {
+	host, port, err := net.SplitHostPort(address)
+	if err != nil {
+		return "", err
+	}
+
+	if host == "" {
+		host = "127.0.0.1"
+	}
+
+	ip := net.ParseIP(host)
+	if host != "localhost" && (ip == nil || !ip.IsLoopback()) {
+		return "", fmt.Errorf("The API can only be served on a loopback address: %s", address)
+	}
+
+	return net.JoinHostPort(host, port), nil
+}
+
+// loaded returns the emulator, or an error if no ROM has been loaded.
+func (a *API) loaded() (*beemo.BMO, error) {
+	if a.bmo == nil {
+		return nil, errors.New("No ROM loaded")
+	}
+
+	return a.bmo, nil
+}
+
+// LoadROM starts emulating a ROM, after saving the external RAM of the
+// previous one.
+func (a *API) LoadROM(args *LoadROMArgs, reply *Empty) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	options := a.options
+	options.ROMPath = args.Path
+
+	bmo, err := beemo.NewBMO(options)
+	if err != nil {
+		return err
+	}
+
+	if a.bmo != nil {
+		err = a.bmo.Shutdown()
+		if err != nil {
+			return err
+		}
+	}
+
+	a.bmo = bmo
+	a.options = options
+
+	return nil
+}
+
+func (a *API) StepFrames(args *CountArgs, reply *Empty) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bmo, err := a.loaded()
+	if err != nil {
+		return err
+	}
+
+	return bmo.RunFrames(args.Count)
+}
+
+func (a *API) StepCycles(args *CountArgs, reply *CyclesReply) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bmo, err := a.loaded()
+	if err != nil {
+		return err
+	}
+
+	reply.Cycles, err = bmo.RunCycles(args.Count)
+
+	return err
+}
+
+// Press presses buttons, which stay pressed until they're released.
+func (a *API) Press(args *ButtonsArgs, reply *Empty) error {
+	return a.setButtons(args.Buttons, true)
+}
+
+func (a *API) Release(args *ButtonsArgs, reply *Empty) error {
+	return a.setButtons(args.Buttons, false)
+}
+
+func (a *API) setButtons(names []string, pressed bool) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bmo, err := a.loaded()
+	if err != nil {
+		return err
+	}
+
+	buttons := make([]byte, len(names))
+	for i, name := range names {
+		buttons[i], err = input.ParseButton(name)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, button := range buttons {
+		bmo.SetButton(button, pressed)
+	}
+
+	return nil
+}
+
+// ReadMemory reads a range of the memory bus without side effects.
+func (a *API) ReadMemory(args *ReadMemoryArgs, reply *MemoryReply) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bmo, err := a.loaded()
+	if err != nil {
+		return err
+	}
+
+	if args.Length < 0 || int(args.Address)+args.Length > addressSpaceSize {
+		return errors.New("Invalid memory range")
+	}
+
+	reply.Data = make([]byte, args.Length)
+	for i := range reply.Data {
+		reply.Data[i] = bmo.PeekByte(args.Address + uint16(i))
+	}
+
+	return nil
+}
+
+// WriteMemory writes a range of the memory bus, as the CPU would (e.g.
+// writes to the ROM switch banks).
+func (a *API) WriteMemory(args *WriteMemoryArgs, reply *Empty) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bmo, err := a.loaded()
+	if err != nil {
+		return err
+	}
+
+	if int(args.Address)+len(args.Data) > addressSpaceSize {
+		return errors.New("Invalid memory range")
+	}
+
+	for i, value := range args.Data {
+		bmo.PokeByte(args.Address+uint16(i), value)
+	}
+
+	return nil
+}
+
+func (a *API) GetRegisters(args *Empty, reply *cpu.Registers) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bmo, err := a.loaded()
+	if err != nil {
+		return err
+	}
+
+	*reply = bmo.Registers()
+
+	return nil
+}
+
+// GetFramebuffer returns the last frame, colorized by the Super Game Boy if
+// any (but without its border).
+func (a *API) GetFramebuffer(args *Empty, reply *FramebufferReply) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bmo, err := a.loaded()
+	if err != nil {
+		return err
+	}
+
+	frame := bmo.Frame()
+
+	reply.Width = ppu.ScreenWidth
+	reply.Height = ppu.ScreenHeight
+	reply.Pixels = make([]byte, 0, ppu.ScreenWidth*ppu.ScreenHeight*3)
+	for i := 0; i < len(frame); i += ppu.ColorDepth {
+		reply.Pixels = append(reply.Pixels, frame[i:i+3]...)
+	}
+	reply.Hash = bmo.FrameHash()
+
+	return nil
+}
+
+func (a *API) SaveState(args *Empty, reply *StateReply) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bmo, err := a.loaded()
+	if err != nil {
+		return err
+	}
+
+	reply.Data, err = bmo.Snapshot()
+
+	return err
+}
+
+func (a *API) LoadState(args *StateArgs, reply *Empty) error {
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	bmo, err := a.loaded()
+	if err != nil {
+		return err
+	}
+
+	return bmo.Restore(args.Data)
+}
@@ -1,16 +1,93 @@
 package beemo
 
 import (
+	"errors"
+	"log"
+	"path/filepath"
+	"strings"
+	"time"
+
 	"github.com/bovarysme/bmo/cartridge"
+	"github.com/bovarysme/bmo/cheat"
+	"github.com/bovarysme/bmo/config"
 	"github.com/bovarysme/bmo/cpu"
 	"github.com/bovarysme/bmo/input"
 	"github.com/bovarysme/bmo/interrupt"
 	"github.com/bovarysme/bmo/mmu"
+	"github.com/bovarysme/bmo/model"
+	"github.com/bovarysme/bmo/movie"
 	"github.com/bovarysme/bmo/ppu"
 	"github.com/bovarysme/bmo/screen"
+	"github.com/bovarysme/bmo/sgb"
 	"github.com/bovarysme/bmo/timer"
+	"github.com/bovarysme/bmo/video"
 )
 
+// Delay within which the quit hotkey has to be pressed again
+const quitConfirmDelay = 3 * time.Second
+
+// Options holds the settings used to build a BMO.
+type Options struct {
+	// Model is the emulated hardware, the DMG by default.
+	Model       model.Model
+	BootromPath string
+	ROMPath     string
+	// Terminal draws the screen in the terminal and reads the keys from it,
+	// instead of opening a window.
+	Terminal bool
+	// Window opens the screen and reads the keys when running neither
+	// headless nor in the terminal. It's left to the caller (e.g.
+	// window.Window or server.Frontend) so that the emulator doesn't depend
+	// on its frontends.
+	Window Window
+	// Screen configures the window and the filters.
+	Screen screen.Options
+	// Headless runs the emulator without a window (and without input).
+	Headless bool
+	// Config holds the key bindings (the default ones if nil).
+	Config *config.Config
+
+	// Lenient disables the VRAM and OAM access restrictions.
+	Lenient bool
+	// Palette replaces the palette chosen in the configuration or the
+	// model's default one.
+	Palette string
+
+	// Cheat codes enabled on top of the ones found in the ROM's cheat file
+	Cheats []string
+
+	// Speed factors applied while the fast-forward and slow-motion hotkeys
+	// are held (0 meaning as fast as possible)
+	FastForwardSpeed float64
+	SlowMotionSpeed  float64
+	// Uncapped disables frame pacing altogether, for benchmarking.
+	Uncapped bool
+
+	// A snapshot is taken for rewinding every RewindInterval frames (0
+	// disabling rewinding), keeping at most RewindBudget bytes of snapshots.
+	RewindInterval int
+	RewindBudget   int
+
+	// Path to a save state to start from
+	StatePath string
+	// Paths to the input movie to record or to play back
+	RecordPath string
+	PlayPath   string
+
+	// Paths to the videos to record ("-" being the standard output for
+	// Y4M and raw RGB videos)
+	GIFPath string
+	Y4MPath string
+	RawPath string
+}
+
+// Window opens the screen and the keys of a frontend, such as a window or web
+// pages.
+type Window interface {
+	Open(width, height int, options screen.Options) (screen.Screen, error)
+	Keys(joypad *input.Joypad, bindings input.Bindings) input.Keys
+}
+
 type BMO struct {
 	cartridge cartridge.Cartridge
 	cpu       *cpu.CPU
@@ -19,56 +96,264 @@ type BMO struct {
 	mmu       *mmu.MMU
 	ppu       *ppu.PPU
 	timer     *timer.Timer
+	// Only set when a Super Game Boy game runs on one
+	sgb *sgb.SGB
+
+	cheats   *cheat.Cheats
+	palettes ppu.Palettes
+
+	hooks Hooks
+	// Displayed frame with the hooks' overlay
+	overlay []byte
+
+	keys     input.Keys
+	bindings input.Bindings
+	screen   screen.Screen
+	// Names of the keys read from the terminal
+	terminalKeys <-chan string
+
+	options  Options
+	pacer    *pacer
+	rewinder *rewinder
+
+	// Movie being recorded, if any
+	movie   *movie.Movie
+	playing bool
+
+	recorders []video.Recorder
+	// GIF being recorded through the hotkey, if any
+	clip *video.GIFRecorder
 
-	keys   input.Keys
-	screen screen.Screen
+	// Number of frames emulated so far
+	frames int
 
 	running bool
+	// Time at which the quit hotkey was last pressed
+	quitRequested time.Time
+
+	paused bool
+	// Set when a single frame has to be run while paused
+	advancing bool
+
+	fastForward bool
+	slowMotion  bool
+	rewinding   bool
+
+	// Leftover CPU cycle when running in double speed mode
+	halfCycle int
 }
 
-func NewBMO(bootromPath, romPath string, screenScale int) (*BMO, error) {
-	c, err := cartridge.NewCartridge(romPath)
+func NewBMO(options Options) (*BMO, error) {
+	c, err := cartridge.NewCartridge(options.ROMPath)
 	if err != nil {
 		return nil, err
 	}
 
-	m, err := mmu.NewMMU(bootromPath, c)
+	if options.Config == nil {
+		options.Config = config.Default()
+	}
+
+	title := c.Header().GameTitle()
+	bindings, err := input.NewBindings(options.Config.GameKeys(title))
 	if err != nil {
 		return nil, err
 	}
 
-	ic := interrupt.NewIC()
-	joypad := input.NewJoypad(ic)
-	p := ppu.NewPPU(m, ic)
-	t := timer.NewTimer(ic)
+	width, height := ppu.ScreenWidth, ppu.ScreenHeight
+	if sgbEnabled(options.Model, c) {
+		width, height = sgb.Width, sgb.Height
+	}
 
-	// XXX
-	m.LinkIC(ic)
-	m.LinkJoypad(joypad)
-	m.LinkPPU(p)
-	m.LinkTimer(t)
+	var s screen.Screen = &screen.NullScreen{}
+	var terminalKeys <-chan string
+	switch {
+	case options.Headless:
+	case options.Terminal:
+		terminal, err := screen.NewTerminalScreen(width, height)
+		if err != nil {
+			return nil, err
+		}
+
+		s = terminal
+		terminalKeys = input.ReadTerminal(terminal.Input())
+	case options.Window == nil:
+		return nil, errors.New("No window to open")
+	default:
+		s, err = options.Window.Open(width, height, options.Screen)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	b := &BMO{
+		cpu:    &cpu.CPU{},
+		ic:     &interrupt.IC{},
+		joypad: &input.Joypad{},
+		mmu:    &mmu.MMU{},
+		ppu:    &ppu.PPU{},
+		timer:  &timer.Timer{},
+
+		bindings:     bindings,
+		screen:       s,
+		terminalKeys: terminalKeys,
+
+		options: options,
+
+		running: true,
+	}
+
+	b.palettes, err = loadPalettes(options, c.Header())
+	if err != nil {
+		return nil, err
+	}
+
+	b.cheats, err = cheat.Load(b.cheatPath())
+	if err != nil {
+		return nil, err
+	}
 
-	keys := input.NewSDLKeys(joypad)
+	for _, code := range options.Cheats {
+		err = b.cheats.Add(code)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	s, err := screen.NewSDLScreen(screenScale)
+	err = b.reset(c)
 	if err != nil {
 		return nil, err
 	}
 
-	return &BMO{
-		cartridge: c,
-		cpu:       cpu.NewCPU(m, ic),
-		ic:        ic,
-		joypad:    joypad,
-		mmu:       m,
-		ppu:       p,
-		timer:     t,
+	b.keys = b.newKeys(b.joypad)
+	b.pacer = newPacer(b.speed())
 
-		keys:   keys,
-		screen: s,
+	if options.StatePath != "" {
+		err = b.LoadStateFile(options.StatePath)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-		running: true,
-	}, nil
+	err = b.startMovie()
+	if err != nil {
+		return nil, err
+	}
+
+	err = b.startRecorders()
+	if err != nil {
+		return nil, err
+	}
+
+	// Rewinding would desynchronize movies.
+	if options.RewindInterval > 0 && b.movie == nil && !b.playing {
+		b.rewinder = newRewinder(options.RewindInterval, options.RewindBudget)
+	}
+
+	return b, nil
+}
+
+// reset powers the system on with a cartridge. The components are reset in
+// place, since the keys and the debugger hold references to them.
+func (b *BMO) reset(c cartridge.Cartridge) error {
+	m, err := mmu.NewMMU(b.options.BootromPath, b.options.Model, b.cheats.Wrap(c))
+	if err != nil {
+		return err
+	}
+
+	b.cartridge = c
+	*b.mmu = *m
+	*b.ic = *interrupt.NewIC()
+	*b.joypad = *input.NewJoypad(b.ic)
+	*b.ppu = *ppu.NewPPU(b.mmu, b.ic)
+	b.ppu.Lenient = b.options.Lenient
+	b.ppu.Palettes = b.palettes
+	*b.timer = *timer.NewTimer(b.ic)
+	*b.cpu = *cpu.NewCPU(b.mmu, b.ic)
+	b.linkHooks()
+
+	// XXX
+	b.mmu.LinkIC(b.ic)
+	b.mmu.LinkJoypad(b.joypad)
+	b.mmu.LinkPPU(b.ppu)
+	b.mmu.LinkTimer(b.timer)
+	b.cpu.LinkClock(b)
+
+	// CGB-only features are only available to CGB games.
+	b.mmu.SetCGB(b.options.Model.IsCGB() && c.Header().CGB())
+
+	b.sgb = nil
+	if sgbEnabled(b.options.Model, c) {
+		b.sgb = sgb.NewSGB(b.ppu)
+		b.joypad.LinkSGB(b.sgb)
+	}
+
+	if b.options.BootromPath == "" {
+		b.skipBoot()
+	}
+
+	b.halfCycle = 0
+
+	return nil
+}
+
+// SoftReset restarts the system from the boot ROM, keeping the contents of
+// the external RAM.
+func (b *BMO) SoftReset() error {
+	if b.movie != nil || b.playing {
+		return errors.New("Can't reset while recording or playing a movie")
+	}
+
+	b.cartridge.Reset()
+
+	err := b.reset(b.cartridge)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Soft reset")
+
+	return nil
+}
+
+// HardReset restarts the system from the boot ROM, reloading the external RAM
+// from the save file.
+func (b *BMO) HardReset() error {
+	if b.movie != nil || b.playing {
+		return errors.New("Can't reset while recording or playing a movie")
+	}
+
+	c, err := cartridge.NewCartridge(b.options.ROMPath)
+	if err != nil {
+		return err
+	}
+
+	err = b.reset(c)
+	if err != nil {
+		return err
+	}
+
+	log.Println("Hard reset")
+
+	return nil
+}
+
+// Pause stops the emulation until Resume is called, the frontend staying
+// responsive in the meantime.
+func (b *BMO) Pause() {
+	b.paused = true
+}
+
+func (b *BMO) Resume() {
+	b.paused = false
+}
+
+func (b *BMO) Paused() bool {
+	return b.paused
+}
+
+// AdvanceFrame runs the emulation for a single frame, even when paused.
+func (b *BMO) AdvanceFrame() error {
+	return b.RunFrames(1)
 }
 
 func (b *BMO) String() string {
@@ -80,42 +365,433 @@ func (b *BMO) GetPC() uint16 {
 	return b.cpu.GetPC()
 }
 
+// Step executes one CPU instruction, the rest of the system being advanced
+// alongside it.
 func (b *BMO) Step() error {
+	_, err := b.step()
+	return err
+}
+
+// step executes one CPU instruction and returns its duration in M-cycles.
+func (b *BMO) step() (int, error) {
 	cycles, err := b.cpu.Step()
 	if err != nil {
-		return err
+		return cycles, err
 	}
 
-	b.ppu.Step(cycles)
 	if b.ppu.VBlank {
 		b.ppu.VBlank = false
 
-		err = b.screen.Render(b.ppu.Pixels)
+		err = b.endFrame()
+	}
+
+	return cycles, err
+}
+
+// RunCycles executes instructions for at least a number of M-cycles, and
+// returns how many were actually run.
+func (b *BMO) RunCycles(cycles int) (int, error) {
+	run := 0
+
+	for b.running && run < cycles {
+		n, err := b.step()
+		run += n
+		if err != nil {
+			return run, err
+		}
+	}
+
+	return run, nil
+}
+
+// newKeys returns the keys used to control a joypad.
+func (b *BMO) newKeys(joypad *input.Joypad) input.Keys {
+	if b.options.Headless {
+		return &input.NullKeys{}
+	}
+
+	if b.options.Terminal {
+		holdTime := time.Duration(b.options.Config.TerminalHoldTime) * time.Millisecond
+		return input.NewTerminalKeys(joypad, b.bindings, b.terminalKeys, holdTime)
+	}
+
+	return b.options.Window.Keys(joypad, b.bindings)
+}
+
+func (b *BMO) endFrame() error {
+	b.frames++
+
+	b.cheats.Apply(b.mmu)
+
+	if b.sgb != nil {
+		b.sgb.Render()
+	}
+
+	if b.hooks.Frame != nil {
+		b.hooks.Frame()
+	}
+
+	err := b.render()
+	if err != nil {
+		return err
+	}
+
+	for _, recorder := range b.recorders {
+		err = recorder.Record(b.Frame())
 		if err != nil {
 			return err
 		}
+	}
+
+	event := b.keys.Read()
+	b.handleEvent(event)
 
-		event := b.keys.Read()
-		if event == input.Quit {
-			b.running = false
+	if b.movie != nil {
+		b.movie.Record(b.joypad.State())
+	}
+
+	if b.rewinder != nil && b.rewinder.frame() {
+		snapshot, err := b.Snapshot()
+		if err != nil {
+			return err
+		}
+
+		err = b.rewinder.push(snapshot)
+		if err != nil {
+			return err
+		}
+	}
+
+	b.pacer.wait(true)
+
+	return nil
+}
+
+// Frame returns the last frame, colorized by the Super Game Boy if any.
+func (b *BMO) Frame() []byte {
+	if b.sgb != nil {
+		return b.sgb.Screen
+	}
+
+	return b.ppu.Pixels
+}
+
+// Shades returns the shade (0 to 3) of each pixel of the last frame, as
+// mapped by the palette registers but not colorized.
+func (b *BMO) Shades() []byte {
+	return b.ppu.Shades
+}
+
+// display returns the last frame as displayed, i.e. with the Super Game Boy
+// border if any.
+func (b *BMO) display() []byte {
+	if b.sgb != nil {
+		return b.sgb.Pixels
+	}
+
+	return b.ppu.Pixels
+}
+
+// pausedFrame keeps displaying the last frame and reading inputs while
+// paused.
+func (b *BMO) pausedFrame() error {
+	err := b.render()
+	if err != nil {
+		return err
+	}
+
+	event := b.keys.Read()
+	b.handleEvent(event)
+
+	b.pacer.wait(false)
+
+	return nil
+}
+
+// rewindFrame restores the previous snapshot, at the pace it was taken.
+func (b *BMO) rewindFrame() error {
+	snapshot, ok, err := b.rewinder.previous()
+	if err != nil {
+		return err
+	}
+
+	if ok {
+		err = b.Restore(snapshot)
+		if err != nil {
+			return err
+		}
+	}
+
+	if b.sgb != nil {
+		b.sgb.Render()
+	}
+
+	err = b.render()
+	if err != nil {
+		return err
+	}
+
+	event := b.keys.Read()
+	b.handleEvent(event)
+
+	for i := 0; i < b.rewinder.interval; i++ {
+		b.pacer.wait(false)
+	}
+
+	return nil
+}
+
+func (b *BMO) handleEvent(event input.Event) {
+	switch event {
+	case input.Quit:
+		b.running = false
+	case input.RequestQuit:
+		b.requestQuit()
+	case input.Pause:
+		b.paused = !b.paused
+	case input.PauseOn, input.PauseOff:
+		b.paused = event == input.PauseOn
+	case input.FrameAdvance:
+		if b.paused {
+			b.advancing = true
+		}
+	case input.Reset:
+		err := b.SoftReset()
+		if err != nil {
+			log.Println(err)
+		}
+	case input.HardReset:
+		err := b.HardReset()
+		if err != nil {
+			log.Println(err)
+		}
+	case input.SaveState:
+		err := b.SaveStateFile(b.statePath())
+		if err != nil {
+			log.Println(err)
+		}
+	case input.LoadState:
+		// Loading a state would desynchronize movies.
+		if b.movie != nil || b.playing {
+			log.Println("Can't load a state while recording or playing a movie")
+			break
+		}
+
+		err := b.LoadStateFile(b.statePath())
+		if err != nil {
+			log.Println(err)
+		}
+	case input.FastForwardPressed, input.FastForwardReleased:
+		b.fastForward = event == input.FastForwardPressed
+		b.pacer.setSpeed(b.speed())
+	case input.SlowMotionPressed, input.SlowMotionReleased:
+		b.slowMotion = event == input.SlowMotionPressed
+		b.pacer.setSpeed(b.speed())
+	case input.RewindPressed, input.RewindReleased:
+		b.rewinding = b.rewinder != nil && event == input.RewindPressed
+	case input.ToggleFullscreen:
+		s, ok := b.screen.(interface {
+			ToggleFullscreen() error
+		})
+		if !ok {
+			break
+		}
+
+		err := s.ToggleFullscreen()
+		if err != nil {
+			log.Println(err)
+		}
+	case input.Screenshot:
+		err := b.Screenshot(b.outputPath(".png"))
+		if err != nil {
+			log.Println(err)
 		}
+	case input.ToggleRecording:
+		err := b.toggleClip()
+		if err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// requestQuit stops the emulator, unless quitting has to be confirmed by
+// pressing the hotkey again shortly after.
+func (b *BMO) requestQuit() {
+	if !b.options.Config.ConfirmQuit || time.Since(b.quitRequested) < quitConfirmDelay {
+		b.running = false
+		return
+	}
+
+	b.quitRequested = time.Now()
+	log.Println("Press the quit key again to quit")
+}
+
+// statePath returns the path of the save state file, next to the ROM file.
+func (b *BMO) statePath() string {
+	ext := filepath.Ext(b.options.ROMPath)
+	return strings.TrimSuffix(b.options.ROMPath, ext) + ".state"
+}
+
+// PeekByte reads a byte from the memory bus without side effects.
+func (b *BMO) PeekByte(address uint16) byte {
+	return b.mmu.PeekByte(address)
+}
+
+// PokeByte writes a byte to the memory bus, as the CPU would.
+func (b *BMO) PokeByte(address uint16, value byte) {
+	b.mmu.WriteByte(address, value)
+}
+
+func (b *BMO) Registers() cpu.Registers {
+	return b.cpu.Registers()
+}
+
+// SetButton presses or releases a joypad button.
+func (b *BMO) SetButton(button byte, pressed bool) {
+	if pressed {
+		b.joypad.SetKey(button)
+	} else {
+		b.joypad.ResetKey(button)
+	}
+}
+
+// CartridgeRAM returns the banks of the external RAM, including the ones that
+// aren't mapped.
+func (b *BMO) CartridgeRAM() [][]byte {
+	return b.cartridge.RAM()
+}
+
+// cheatPath returns the path of the ROM's cheat file.
+func (b *BMO) cheatPath() string {
+	ext := filepath.Ext(b.options.ROMPath)
+	return strings.TrimSuffix(b.options.ROMPath, ext) + ".cheats.json"
+}
+
+// Cheats returns the cheats, so that they can be added or toggled.
+func (b *BMO) Cheats() *cheat.Cheats {
+	return b.cheats
+}
+
+// Screenshot writes the last frame to a PNG file.
+func (b *BMO) Screenshot(path string) error {
+	err := screen.SavePNG(b.Frame(), path)
+	if err != nil {
+		return err
 	}
 
+	log.Printf("Saved screenshot to '%s' (hash: %s)\n", path, b.FrameHash())
+
+	return nil
+}
+
+// FrameHash returns a stable hash of the last frame.
+func (b *BMO) FrameHash() string {
+	return screen.Hash(b.Frame())
+}
+
+// outputPath returns a path next to the ROM file, named after the ROM and
+// the current time.
+func (b *BMO) outputPath(ext string) string {
+	romExt := filepath.Ext(b.options.ROMPath)
+	name := strings.TrimSuffix(b.options.ROMPath, romExt)
+
+	return name + time.Now().Format("-20060102-150405") + ext
+}
+
+func (b *BMO) speed() float64 {
+	switch {
+	case b.fastForward:
+		return b.options.FastForwardSpeed
+	case b.slowMotion:
+		return b.options.SlowMotionSpeed
+	case b.options.Uncapped:
+		return 0
+	}
+
+	return 1
+}
+
+// Tick advances the PPU, the timer and the OAM DMA by a number of M-cycles.
+func (b *BMO) Tick(cycles int) {
+	b.mmu.Step(cycles)
+
+	// The PPU isn't affected by the CGB double speed mode.
+	ppuCycles := cycles
+	if b.mmu.DoubleSpeed() {
+		ppuCycles = (cycles + b.halfCycle) / 2
+		b.halfCycle = (cycles + b.halfCycle) % 2
+	}
+
+	b.ppu.Step(ppuCycles)
 	b.timer.Step(cycles)
+}
+
+// RunFrames runs the emulator for a number of frames.
+func (b *BMO) RunFrames(frames int) error {
+	target := b.frames + frames
+
+	for b.running && b.frames < target {
+		err := b.Step()
+		if err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
 
 func (b *BMO) Run() error {
 	for b.running {
-		err := b.Step()
+		var err error
+		switch {
+		case b.rewinding:
+			err = b.rewindFrame()
+		case b.advancing:
+			b.advancing = false
+			err = b.AdvanceFrame()
+		case b.paused:
+			err = b.pausedFrame()
+		default:
+			err = b.Step()
+		}
+
 		if err != nil {
 			return err
 		}
 	}
 
-	b.cartridge.Save()
-	b.screen.Shutdown()
+	if b.options.Uncapped {
+		log.Printf("Average speed: %.2f FPS\n", b.pacer.fps())
+	}
+
+	return b.Shutdown()
+}
+
+// Shutdown saves the external RAM, the movie and the videos being recorded,
+// and closes the window.
+func (b *BMO) Shutdown() error {
+	defer b.screen.Shutdown()
+
+	if b.movie != nil {
+		err := b.movie.Save(b.options.RecordPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, recorder := range b.recorders {
+		err := recorder.Close()
+		if err != nil {
+			return err
+		}
+	}
+	b.recorders = nil
+
+	// The external RAM restored from a movie isn't the player's, and
+	// headless runs shouldn't have side effects.
+	if !b.playing && !b.options.Headless {
+		b.cartridge.Save()
+	}
 
 	return nil
 }
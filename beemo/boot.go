@@ -0,0 +1,78 @@
+package beemo
+
+import (
+	"fmt"
+
+	"github.com/bovarysme/bmo/cartridge"
+	"github.com/bovarysme/bmo/input"
+	"github.com/bovarysme/bmo/interrupt"
+	"github.com/bovarysme/bmo/model"
+	"github.com/bovarysme/bmo/palette"
+	"github.com/bovarysme/bmo/ppu"
+	"github.com/bovarysme/bmo/sgb"
+)
+
+// Values of the timer's internal counter when each model's boot ROM hands
+// over. The SGB and CGB ones depend on how long the boot ROM ran, and aren't
+// known.
+var postBootCounters = map[model.Model]uint16{
+	model.DMG0: 0x1800,
+	model.DMG:  0xabcc,
+	model.MGB:  0xabcc,
+}
+
+// Default palette of each model, the CGB one depending on the game
+var modelPalettes = map[model.Model]string{
+	model.DMG0: "green",
+	model.DMG:  "green",
+	model.MGB:  "gray",
+	model.SGB:  "sgb",
+	model.SGB2: "sgb",
+}
+
+// loadPalettes returns the palettes chosen in the options or in the
+// configuration file, or else the model's default ones.
+func loadPalettes(options Options, header *cartridge.Header) (ppu.Palettes, error) {
+	name := options.Palette
+	if name == "" {
+		name = options.Config.GamePalette(header.GameTitle())
+	}
+
+	if name == "" {
+		if options.Model.IsCGB() {
+			return palette.ForCGB(header), nil
+		}
+
+		name = modelPalettes[options.Model]
+	}
+
+	custom, ok := options.Config.Palettes[name]
+	if ok {
+		return palette.Custom(custom.BG, custom.OBJ0, custom.OBJ1)
+	}
+
+	preset, ok := palette.Presets[name]
+	if !ok {
+		return ppu.Palettes{}, fmt.Errorf("Unknown palette: %s", name)
+	}
+
+	return preset, nil
+}
+
+// sgbEnabled returns whether the Super Game Boy functions are available to a
+// game.
+func sgbEnabled(m model.Model, c cartridge.Cartridge) bool {
+	return m.IsSGB() && sgb.Supported(c.Header())
+}
+
+// skipBoot puts the system in the state left by the boot ROM, when running
+// without one.
+func (b *BMO) skipBoot() {
+	b.mmu.SkipBoot(b.options.Model)
+	b.mmu.WriteByte(input.P1, 0x30)
+	b.mmu.WriteByte(interrupt.IR, 0xe1)
+
+	b.timer.SkipBoot(postBootCounters[b.options.Model])
+	b.ppu.SkipBoot(b.options.Model)
+	b.cpu.SkipBoot(b.options.Model, b.cartridge.Header())
+}
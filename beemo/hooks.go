@@ -0,0 +1,48 @@
+package beemo
+
+import (
+	"github.com/bovarysme/bmo/ppu"
+	"github.com/bovarysme/bmo/sgb"
+)
+
+// Hooks let scripts follow and alter the emulation. Nil hooks are skipped.
+type Hooks struct {
+	// Frame is called at the end of each frame, before it's displayed.
+	Frame func()
+	// Exec is called before the CPU executes the instruction at an address.
+	Exec func(address uint16)
+	// Write is called after the CPU writes a byte to the memory bus.
+	Write func(address uint16, value byte)
+	// Overlay draws over a copy of the displayed frame, which doesn't
+	// change the frames recorded.
+	Overlay func(pixels []byte, width, height int)
+}
+
+func (b *BMO) SetHooks(hooks Hooks) {
+	b.hooks = hooks
+	b.linkHooks()
+}
+
+// linkHooks sets the CPU's hooks, which are lost when it's reset.
+func (b *BMO) linkHooks() {
+	b.cpu.ExecHook = b.hooks.Exec
+	b.cpu.WriteHook = b.hooks.Write
+}
+
+// render displays the last frame, with the overlay if any.
+func (b *BMO) render() error {
+	pixels := b.display()
+
+	if b.hooks.Overlay != nil {
+		width, height := ppu.ScreenWidth, ppu.ScreenHeight
+		if b.sgb != nil {
+			width, height = sgb.Width, sgb.Height
+		}
+
+		b.overlay = append(b.overlay[:0], pixels...)
+		b.hooks.Overlay(b.overlay, width, height)
+		pixels = b.overlay
+	}
+
+	return b.screen.Render(pixels)
+}
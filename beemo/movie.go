@@ -0,0 +1,49 @@
+package beemo
+
+import (
+	"errors"
+
+	"github.com/bovarysme/bmo/input"
+	"github.com/bovarysme/bmo/interrupt"
+	"github.com/bovarysme/bmo/movie"
+)
+
+// startMovie starts playing back or recording a movie, depending on the
+// options.
+func (b *BMO) startMovie() error {
+	if b.options.PlayPath != "" {
+		m, err := movie.Load(b.options.PlayPath)
+		if err != nil {
+			return err
+		}
+
+		if m.ROMChecksum != b.cartridge.Checksum() {
+			return errors.New("Movie recorded with a different ROM")
+		}
+
+		err = b.Restore(m.State)
+		if err != nil {
+			return err
+		}
+
+		// Keys pressed during playback only trigger events, since they're
+		// linked to a joypad which isn't part of the system.
+		keys := b.newKeys(input.NewJoypad(interrupt.NewIC()))
+		b.keys = movie.NewPlayer(m, b.joypad, keys)
+		b.playing = true
+	} else if b.options.RecordPath != "" {
+		state, err := b.Snapshot()
+		if err != nil {
+			return err
+		}
+
+		startCondition := movie.PowerOn
+		if b.options.StatePath != "" {
+			startCondition = movie.SaveState
+		}
+
+		b.movie = movie.NewMovie(b.cartridge.Checksum(), startCondition, state)
+	}
+
+	return nil
+}
@@ -0,0 +1,78 @@
+package beemo
+
+import (
+	"time"
+)
+
+const (
+	clockSpeed = 4194304 // Hz
+	frameDots  = 70224
+
+	frameDuration = time.Second * frameDots / clockSpeed
+
+	// How far the emulation can fall behind before the pacer stops trying
+	// to catch up
+	maxLag = 4 * frameDuration
+)
+
+// pacer throttles the emulation to the Game Boy's frame rate (about
+// 59.73 Hz), scaled by a speed factor.
+type pacer struct {
+	// A speed of 0 means the emulation isn't throttled.
+	speed    float64
+	deadline time.Time
+
+	// Emulated frames and the time spent running them, for the average
+	// speed
+	frames  int
+	elapsed time.Duration
+	last    time.Time
+}
+
+func newPacer(speed float64) *pacer {
+	return &pacer{
+		speed: speed,
+		last:  time.Now(),
+	}
+}
+
+func (p *pacer) setSpeed(speed float64) {
+	p.speed = speed
+	p.deadline = time.Time{}
+}
+
+// wait blocks until the next frame is due. Only emulated frames count towards
+// the average speed, unlike the ones displayed while paused or rewinding.
+func (p *pacer) wait(emulated bool) {
+	p.sleep()
+
+	now := time.Now()
+	if emulated {
+		p.frames++
+		p.elapsed += now.Sub(p.last)
+	}
+	p.last = now
+}
+
+func (p *pacer) sleep() {
+	if p.speed == 0 {
+		return
+	}
+
+	now := time.Now()
+	if p.deadline.IsZero() || now.Sub(p.deadline) > maxLag {
+		p.deadline = now
+	}
+
+	p.deadline = p.deadline.Add(time.Duration(float64(frameDuration) / p.speed))
+
+	delay := p.deadline.Sub(now)
+	if delay > 0 {
+		time.Sleep(delay)
+	}
+}
+
+// fps returns the average number of frames emulated per second.
+func (p *pacer) fps() float64 {
+	return float64(p.frames) / p.elapsed.Seconds()
+}
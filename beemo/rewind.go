@@ -0,0 +1,189 @@
+package beemo
+
+import (
+	"bytes"
+	"compress/flate"
+	"io/ioutil"
+)
+
+// rewinder keeps snapshots of the machine taken every few frames, within a
+// memory budget. The most recent snapshot is kept as is, and each older one
+// is stored as a compressed delta against the snapshot following it, so
+// that the oldest snapshots can be dropped without decoding the others.
+type rewinder struct {
+	interval int
+	budget   int
+
+	// Frames elapsed since the last snapshot
+	frames int
+
+	current []byte
+	deltas  ring
+	size    int
+}
+
+func newRewinder(interval, budget int) *rewinder {
+	return &rewinder{
+		interval: interval,
+		budget:   budget,
+	}
+}
+
+// frame is called at the end of each frame, and returns whether a snapshot is
+// due.
+func (r *rewinder) frame() bool {
+	r.frames++
+
+	return r.frames >= r.interval
+}
+
+func (r *rewinder) push(snapshot []byte) error {
+	r.frames = 0
+
+	if len(snapshot) != len(r.current) {
+		r.reset()
+	}
+
+	if r.current != nil {
+		delta, err := compress(xor(r.current, snapshot))
+		if err != nil {
+			return err
+		}
+
+		r.deltas.pushBack(delta)
+		r.size += len(delta)
+	}
+
+	r.current = snapshot
+
+	for r.size+len(r.current) > r.budget && r.deltas.length > 0 {
+		delta := r.deltas.popFront()
+		r.size -= len(delta)
+	}
+
+	return nil
+}
+
+// previous returns the snapshot preceding the current state, going back to
+// the last snapshot first if frames have elapsed since it was taken.
+func (r *rewinder) previous() ([]byte, bool, error) {
+	if r.current == nil {
+		return nil, false, nil
+	}
+
+	if r.frames > 0 {
+		r.frames = 0
+		return r.current, true, nil
+	}
+
+	if r.deltas.length == 0 {
+		return nil, false, nil
+	}
+
+	delta := r.deltas.popBack()
+	r.size -= len(delta)
+
+	data, err := decompress(delta)
+	if err != nil {
+		return nil, false, err
+	}
+
+	r.current = xor(r.current, data)
+
+	return r.current, true, nil
+}
+
+func (r *rewinder) reset() {
+	r.current = nil
+	r.deltas = ring{}
+	r.size = 0
+}
+
+func xor(a, b []byte) []byte {
+	result := make([]byte, len(a))
+	for i := range a {
+		result[i] = a[i] ^ b[i]
+	}
+
+	return result
+}
+
+func compress(data []byte) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	writer, err := flate.NewWriter(&buffer, flate.BestSpeed)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = writer.Write(data)
+	if err != nil {
+		return nil, err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+func decompress(data []byte) ([]byte, error) {
+	reader := flate.NewReader(bytes.NewReader(data))
+	defer reader.Close()
+
+	return ioutil.ReadAll(reader)
+}
+
+// ring is a double-ended queue of byte slices backed by a ring buffer.
+type ring struct {
+	entries [][]byte
+	start   int
+	length  int
+}
+
+func (r *ring) pushBack(entry []byte) {
+	if r.length == len(r.entries) {
+		r.grow()
+	}
+
+	r.entries[(r.start+r.length)%len(r.entries)] = entry
+	r.length++
+}
+
+func (r *ring) popFront() []byte {
+	entry := r.entries[r.start]
+	r.entries[r.start] = nil
+
+	r.start = (r.start + 1) % len(r.entries)
+	r.length--
+
+	return entry
+}
+
+func (r *ring) popBack() []byte {
+	index := (r.start + r.length - 1) % len(r.entries)
+
+	entry := r.entries[index]
+	r.entries[index] = nil
+
+	r.length--
+
+	return entry
+}
+
+func (r *ring) grow() {
+	size := 2 * len(r.entries)
+	if size == 0 {
+		size = 64
+	}
+
+	entries := make([][]byte, size)
+	for i := 0; i < r.length; i++ {
+		entries[i] = r.entries[(r.start+i)%len(r.entries)]
+	}
+
+	r.entries = entries
+	r.start = 0
+}
@@ -0,0 +1,173 @@
+package beemo
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+)
+
+const stateVersion = 3
+
+var stateMagic = [4]byte{'B', 'M', 'O', 'S'}
+
+type stateHeader struct {
+	Magic   [4]byte
+	Version byte
+	// CRC-32 of the ROM the state was saved with
+	ROMChecksum uint32
+}
+
+type stateful interface {
+	SaveState(w io.Writer) error
+	LoadState(r io.Reader) error
+}
+
+func (b *BMO) components() []stateful {
+	components := []stateful{b.cpu, b.ic, b.joypad, b.mmu, b.ppu, b.timer, b.cartridge}
+	if b.sgb != nil {
+		components = append(components, b.sgb)
+	}
+
+	return components
+}
+
+// SaveState writes the state of the whole machine.
+func (b *BMO) SaveState(w io.Writer) error {
+	header := stateHeader{
+		Magic:       stateMagic,
+		Version:     stateVersion,
+		ROMChecksum: b.cartridge.Checksum(),
+	}
+
+	err := binary.Write(w, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+
+	for _, component := range b.components() {
+		err = component.SaveState(w)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// LoadState restores a state written by SaveState. The state is read in full
+// first, and the machine is left untouched if it turns out to be invalid
+// (e.g. truncated).
+func (b *BMO) LoadState(r io.Reader) error {
+	state, err := ioutil.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	snapshot, err := b.Snapshot()
+	if err != nil {
+		return err
+	}
+
+	err = b.loadState(state)
+	if err != nil {
+		// The snapshot was just taken, so restoring it can't fail.
+		b.loadState(snapshot)
+		return err
+	}
+
+	return nil
+}
+
+func (b *BMO) loadState(state []byte) error {
+	r := bytes.NewReader(state)
+
+	var header stateHeader
+	err := binary.Read(r, binary.LittleEndian, &header)
+	if err != nil {
+		return err
+	}
+
+	if header.Magic != stateMagic || header.Version != stateVersion {
+		return errors.New("Invalid save state")
+	}
+
+	if header.ROMChecksum != b.cartridge.Checksum() {
+		return errors.New("Save state made with a different ROM")
+	}
+
+	for _, component := range b.components() {
+		err = component.LoadState(r)
+		if err != nil {
+			return err
+		}
+	}
+
+	if r.Len() != 0 {
+		return errors.New("Invalid save state")
+	}
+
+	return nil
+}
+
+// Snapshot returns the state of the whole machine.
+func (b *BMO) Snapshot() ([]byte, error) {
+	var buffer bytes.Buffer
+
+	err := b.SaveState(&buffer)
+	if err != nil {
+		return nil, err
+	}
+
+	return buffer.Bytes(), nil
+}
+
+// Restore restores a state returned by Snapshot.
+func (b *BMO) Restore(snapshot []byte) error {
+	return b.LoadState(bytes.NewReader(snapshot))
+}
+
+func (b *BMO) SaveStateFile(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer := bufio.NewWriter(file)
+
+	err = b.SaveState(writer)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Saved state to '%s'\n", path)
+
+	return nil
+}
+
+func (b *BMO) LoadStateFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	err = b.LoadState(bufio.NewReader(file))
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Loaded state from '%s'\n", path)
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package beemo
+
+import (
+	"github.com/bovarysme/bmo/video"
+)
+
+func (b *BMO) startRecorders() error {
+	if b.options.GIFPath != "" {
+		recorder, err := video.NewGIFRecorder(b.options.GIFPath, b.ppu.Palettes.BG)
+		if err != nil {
+			return err
+		}
+
+		b.recorders = append(b.recorders, recorder)
+	}
+
+	if b.options.Y4MPath != "" {
+		recorder, err := video.NewY4MRecorder(b.options.Y4MPath)
+		if err != nil {
+			return err
+		}
+
+		b.recorders = append(b.recorders, recorder)
+	}
+
+	if b.options.RawPath != "" {
+		recorder, err := video.NewRawRecorder(b.options.RawPath)
+		if err != nil {
+			return err
+		}
+
+		b.recorders = append(b.recorders, recorder)
+	}
+
+	return nil
+}
+
+// toggleClip starts or stops recording a GIF next to the ROM file.
+func (b *BMO) toggleClip() error {
+	if b.clip == nil {
+		clip, err := video.NewGIFRecorder(b.outputPath(".gif"), b.ppu.Palettes.BG)
+		if err != nil {
+			return err
+		}
+
+		b.clip = clip
+		b.recorders = append(b.recorders, clip)
+
+		return nil
+	}
+
+	for i, recorder := range b.recorders {
+		if recorder == b.clip {
+			b.recorders = append(b.recorders[:i], b.recorders[i+1:]...)
+			break
+		}
+	}
+
+	err := b.clip.Close()
+	b.clip = nil
+
+	return err
+}
@@ -5,6 +5,8 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"hash/crc32"
+	"io"
 	"io/ioutil"
 	"log"
 	"os"
@@ -44,6 +46,39 @@ type Header struct {
 	GlobalChecksum   [2]byte
 }
 
+// GameTitle returns the title, without its padding and the CGB flag found
+// in the last byte of newer titles.
+func (h *Header) GameTitle() string {
+	title := h.Title[:]
+	if h.CGB() {
+		title = title[:15]
+	}
+
+	return strings.TrimRight(string(title), "\x00")
+}
+
+// CGB returns whether the game supports the CGB features.
+func (h *Header) CGB() bool {
+	return h.Title[15]&0x80 == 0x80
+}
+
+// Nintendo returns whether the game was published by Nintendo.
+func (h *Header) Nintendo() bool {
+	return h.OldLicenseeCode == 0x01 ||
+		h.OldLicenseeCode == 0x33 && h.NewLicenseeCode == [2]byte{'0', '1'}
+}
+
+// TitleChecksum returns the sum of the title's bytes, which the CGB boot ROM
+// uses to identify the games published by Nintendo.
+func (h *Header) TitleChecksum() byte {
+	var sum byte
+	for _, b := range h.Title {
+		sum += b
+	}
+
+	return sum
+}
+
 func NewHeader(data []byte) (*Header, error) {
 	header := &Header{}
 
@@ -56,10 +91,35 @@ func NewHeader(data []byte) (*Header, error) {
 	return header, nil
 }
 
+// romInfo holds what's known about the ROM regardless of the cartridge type.
+type romInfo struct {
+	header   *Header
+	checksum uint32
+}
+
+func (r *romInfo) Header() *Header {
+	return r.header
+}
+
+// Checksum returns the CRC-32 of the whole ROM.
+func (r *romInfo) Checksum() uint32 {
+	return r.checksum
+}
+
 type Cartridge interface {
 	ReadByte(address uint16) byte
 	WriteByte(address uint16, value byte)
 	Save() error
+
+	Header() *Header
+	Checksum() uint32
+	// Reset resets the bank registers, keeping the contents of the RAM.
+	Reset()
+	// RAM returns the banks of the external RAM.
+	RAM() [][]byte
+
+	SaveState(w io.Writer) error
+	LoadState(r io.Reader) error
 }
 
 func NewCartridge(romPath string) (Cartridge, error) {
@@ -87,17 +147,27 @@ func NewCartridge(romPath string) (Cartridge, error) {
 		}
 	}
 
+	info := romInfo{
+		header:   header,
+		checksum: crc32.ChecksumIEEE(rom),
+	}
+
 	var cartridge Cartridge
 
 	switch header.Type {
 	case 0x00:
 		cartridge = &ROM{
-			rom: rom,
+			romInfo: info,
+			rom:     rom,
 		}
 	case 0x01, 0x02, 0x03:
-		cartridge = NewMBC1(header.Type, romPath, rom, ram)
+		mbc := NewMBC1(header.Type, romPath, rom, ram)
+		mbc.romInfo = info
+		cartridge = mbc
 	case 0x11, 0x12, 0x13:
-		cartridge = NewMBC3(header.Type, romPath, rom, ram)
+		mbc := NewMBC3(header.Type, romPath, rom, ram)
+		mbc.romInfo = info
+		cartridge = mbc
 	default:
 		return nil, &UnknownCartridgeTypeError{cartridgeType: header.Type}
 	}
@@ -202,3 +272,33 @@ func saveRAM(path string, ram [][]byte) error {
 
 	return nil
 }
+
+// mbcState holds the state shared by the memory bank controllers.
+type mbcState struct {
+	ROMBank     byte
+	RAMEnabled  bool
+	RAMBank     byte
+	BankingMode byte
+}
+
+func saveBanks(w io.Writer, ram [][]byte) error {
+	for _, bank := range ram {
+		_, err := w.Write(bank)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func loadBanks(r io.Reader, ram [][]byte) error {
+	for _, bank := range ram {
+		_, err := io.ReadFull(r, bank)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -1,6 +1,13 @@
 package cartridge
 
+import (
+	"encoding/binary"
+	"io"
+)
+
 type MBC1 struct {
+	romInfo
+
 	cartType byte
 
 	// Path to the ROM file
@@ -37,9 +44,11 @@ func (m *MBC1) ReadByte(address uint16) byte {
 		addr := uint32(address) + 0x4000*(uint32(m.romBank)-1)
 		value = m.rom[addr]
 	case address >= 0xa000 && address <= 0xbfff:
-		if m.ramEnabled {
+		// Reads from disabled or missing RAM return an open bus value.
+		value = 0xff
+		if m.ramEnabled && int(m.ramBank) < len(m.ram) {
 			address -= 0xa000
-			value = m.ram[m.ramBank][address]
+			value = m.ram[m.ramBank][int(address)%len(m.ram[m.ramBank])]
 		}
 	}
 
@@ -61,13 +70,24 @@ func (m *MBC1) WriteByte(address uint16, value byte) {
 	case address >= 0x6000 && address <= 0x7fff:
 		m.bankingMode = value & 1
 	case address >= 0xa000 && address <= 0xbfff:
-		if m.ramEnabled {
+		if m.ramEnabled && int(m.ramBank) < len(m.ram) {
 			address -= 0xa000
-			m.ram[m.ramBank][address] = value
+			m.ram[m.ramBank][int(address)%len(m.ram[m.ramBank])] = value
 		}
 	}
 }
 
+func (m *MBC1) RAM() [][]byte {
+	return m.ram
+}
+
+func (m *MBC1) Reset() {
+	m.romBank = 1
+	m.ramEnabled = false
+	m.ramBank = 0
+	m.bankingMode = romBanking
+}
+
 func (m *MBC1) Save() error {
 	var err error
 
@@ -86,3 +106,35 @@ func (m *MBC1) updateROMBank(value, mask byte) {
 		m.romBank++
 	}
 }
+
+func (m *MBC1) SaveState(w io.Writer) error {
+	state := mbcState{
+		ROMBank:     m.romBank,
+		RAMEnabled:  m.ramEnabled,
+		RAMBank:     m.ramBank,
+		BankingMode: m.bankingMode,
+	}
+
+	err := binary.Write(w, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+
+	return saveBanks(w, m.ram)
+}
+
+func (m *MBC1) LoadState(r io.Reader) error {
+	var state mbcState
+
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+
+	m.romBank = state.ROMBank
+	m.ramEnabled = state.RAMEnabled
+	m.ramBank = state.RAMBank
+	m.bankingMode = state.BankingMode
+
+	return loadBanks(r, m.ram)
+}
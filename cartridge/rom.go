@@ -1,10 +1,21 @@
 package cartridge
 
+import (
+	"io"
+)
+
 type ROM struct {
+	romInfo
+
 	rom []byte
 }
 
 func (r *ROM) ReadByte(address uint16) byte {
+	// There's no external RAM to read from.
+	if int(address) >= len(r.rom) {
+		return 0xff
+	}
+
 	return r.rom[address]
 }
 
@@ -12,6 +23,22 @@ func (r *ROM) WriteByte(address uint16, value byte) {
 
 }
 
+func (r *ROM) RAM() [][]byte {
+	return nil
+}
+
+func (r *ROM) Reset() {
+
+}
+
 func (r *ROM) Save() error {
 	return nil
 }
+
+func (r *ROM) SaveState(w io.Writer) error {
+	return nil
+}
+
+func (r *ROM) LoadState(rd io.Reader) error {
+	return nil
+}
@@ -0,0 +1,130 @@
+package cheat
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+
+	"github.com/bovarysme/bmo/cartridge"
+)
+
+type Memory interface {
+	WriteByte(address uint16, value byte)
+}
+
+// Cheat is a Game Genie or a GameShark code, as found in the cheat files.
+type Cheat struct {
+	Code        string `json:"code"`
+	Description string `json:"description,omitempty"`
+	Enabled     bool   `json:"enabled"`
+
+	genie *genieCode
+	shark *sharkCode
+}
+
+// Parse decodes a Game Genie (ABC-DEF-GHI or ABC-DEF) or a GameShark
+// (01VVAAAA) code. The returned cheat is enabled.
+func Parse(code string) (*Cheat, error) {
+	cheat := &Cheat{
+		Code:    code,
+		Enabled: true,
+	}
+
+	err := cheat.parse()
+	if err != nil {
+		return nil, err
+	}
+
+	return cheat, nil
+}
+
+func (c *Cheat) parse() error {
+	code := strings.ToUpper(strings.TrimSpace(c.Code))
+
+	var err error
+	if strings.Contains(code, "-") {
+		c.genie, err = parseGenie(code)
+	} else {
+		c.shark, err = parseShark(code)
+	}
+
+	if err != nil {
+		return fmt.Errorf("Invalid cheat code '%s': %s", c.Code, err)
+	}
+
+	return nil
+}
+
+type Cheats struct {
+	cheats []*Cheat
+}
+
+func NewCheats() *Cheats {
+	return &Cheats{}
+}
+
+// Load reads a JSON list of cheats. A missing file yields an empty list.
+func Load(path string) (*Cheats, error) {
+	c := NewCheats()
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return c, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	err = json.NewDecoder(file).Decode(&c.cheats)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, cheat := range c.cheats {
+		err = cheat.parse()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	log.Printf("Loaded %d cheats from '%s'\n", len(c.cheats), path)
+
+	return c, nil
+}
+
+func (c *Cheats) Add(code string) error {
+	cheat, err := Parse(code)
+	if err != nil {
+		return err
+	}
+
+	c.cheats = append(c.cheats, cheat)
+
+	return nil
+}
+
+// List returns the cheats, which can be enabled and disabled in place.
+func (c *Cheats) List() []*Cheat {
+	return c.cheats
+}
+
+// Apply writes the values of the enabled GameShark codes. It is meant to be
+// called at VBlank, once a frame.
+func (c *Cheats) Apply(m Memory) {
+	for _, cheat := range c.cheats {
+		if cheat.Enabled && cheat.shark != nil {
+			m.WriteByte(cheat.shark.address, cheat.shark.value)
+		}
+	}
+}
+
+// Wrap returns a cartridge whose ROM reads are patched by the enabled Game
+// Genie codes.
+func (c *Cheats) Wrap(cart cartridge.Cartridge) cartridge.Cartridge {
+	return &patchedCartridge{
+		Cartridge: cart,
+		cheats:    c,
+	}
+}
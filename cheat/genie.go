@@ -0,0 +1,81 @@
+package cheat
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+
+	"github.com/bovarysme/bmo/cartridge"
+)
+
+type genieCode struct {
+	address uint16
+	value   byte
+
+	compare    byte
+	hasCompare bool
+}
+
+// parseGenie decodes an ABC-DEF-GHI code: AB is the new value, FCDE the
+// address XORed with 0xf000 and GI the compared value, rotated and XORed
+// with 0xba. H is not used.
+func parseGenie(code string) (*genieCode, error) {
+	digits := strings.Replace(code, "-", "", -1)
+	if len(digits) != 9 && len(digits) != 6 {
+		return nil, errors.New("Game Genie codes are formatted as ABC-DEF-GHI or ABC-DEF")
+	}
+
+	d := make([]uint16, len(digits))
+	for i, digit := range digits {
+		value, err := strconv.ParseUint(string(digit), 16, 4)
+		if err != nil {
+			return nil, err
+		}
+
+		d[i] = uint16(value)
+	}
+
+	g := &genieCode{
+		address: (d[5]^0xf)<<12 | d[2]<<8 | d[3]<<4 | d[4],
+		value:   byte(d[0]<<4 | d[1]),
+	}
+
+	if g.address >= 0x8000 {
+		return nil, errors.New("Game Genie codes can only patch the ROM")
+	}
+
+	if len(d) == 9 {
+		compare := byte(d[6]<<4 | d[8])
+		g.compare = (compare>>2 | compare<<6) ^ 0xba
+		g.hasCompare = true
+	}
+
+	return g, nil
+}
+
+type patchedCartridge struct {
+	cartridge.Cartridge
+
+	cheats *Cheats
+}
+
+func (p *patchedCartridge) ReadByte(address uint16) byte {
+	value := p.Cartridge.ReadByte(address)
+	if address >= 0x8000 {
+		return value
+	}
+
+	for _, cheat := range p.cheats.cheats {
+		g := cheat.genie
+		if !cheat.Enabled || g == nil || g.address != address {
+			continue
+		}
+
+		// The compared value tells apart the banks mapped at the address.
+		if !g.hasCompare || g.compare == value {
+			return g.value
+		}
+	}
+
+	return value
+}
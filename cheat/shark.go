@@ -0,0 +1,36 @@
+package cheat
+
+import (
+	"errors"
+	"strconv"
+)
+
+type sharkCode struct {
+	address uint16
+	value   byte
+}
+
+// parseShark decodes a TTVVAAAA code: TT is the RAM bank (usually 01), VV
+// the value and AAAA the address, low byte first. The bank is ignored, the
+// value being written to whichever bank is mapped at the address.
+func parseShark(code string) (*sharkCode, error) {
+	if len(code) != 8 {
+		return nil, errors.New("GameShark codes are formatted as 01VVAAAA")
+	}
+
+	n, err := strconv.ParseUint(code, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &sharkCode{
+		value:   byte(n >> 16),
+		address: uint16(n>>8&0xff | n&0xff<<8),
+	}
+
+	if s.address < 0xa000 || s.address >= 0xe000 {
+		return nil, errors.New("GameShark codes can only write to the RAM")
+	}
+
+	return s, nil
+}
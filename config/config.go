@@ -0,0 +1,151 @@
+package config
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"strings"
+)
+
+// Game holds the settings overridden for a single game.
+type Game struct {
+	// Keys bound to the actions, replacing the default ones
+	Keys map[string][]string `json:"keys"`
+	// Palette replacing the default one
+	Palette string `json:"palette"`
+}
+
+// Palette holds the colors of a user palette, formatted as "#rrggbb" from the
+// lightest one. The sprites' palettes default to the background one.
+type Palette struct {
+	BG   []string `json:"bg"`
+	OBJ0 []string `json:"obj0"`
+	OBJ1 []string `json:"obj1"`
+}
+
+// Config holds the settings loaded from the configuration file.
+type Config struct {
+	// Keys bound to each action (i.e. joypad buttons and hotkeys), named
+	// after SDL key names
+	Keys map[string][]string `json:"keys"`
+	// ConfirmQuit requires the quit hotkey to be pressed twice.
+	ConfirmQuit bool `json:"confirm_quit"`
+	// Milliseconds for which keys read from the terminal are held after
+	// being pressed (the input package's default if 0)
+	TerminalHoldTime int `json:"terminal_hold_time"`
+
+	// Name of the palette used instead of the model's default one, either
+	// a preset or a user palette
+	Palette  string             `json:"palette"`
+	Palettes map[string]Palette `json:"palettes"`
+
+	// Settings overridden for each game, keyed by ROM title
+	Games map[string]Game `json:"games"`
+}
+
+func Default() *Config {
+	return &Config{
+		Keys: map[string][]string{
+			"right":  {"Right"},
+			"left":   {"Left"},
+			"up":     {"Up"},
+			"down":   {"Down"},
+			"a":      {"A"},
+			"b":      {"S"},
+			"select": {"C"},
+			"start":  {"V"},
+
+			"quit":          {"Q"},
+			"pause":         {"P"},
+			"frame_advance": {"N"},
+			"reset":         {"R"},
+			"hard_reset":    {"F9"},
+			"save_state":    {"F5"},
+			"load_state":    {"F7"},
+			"fast_forward":  {"Tab"},
+			"slow_motion":   {"Left Shift"},
+			"rewind":        {"Backspace"},
+			"fullscreen":    {"F11"},
+			"screenshot":    {"F12"},
+			"record":        {"F10"},
+		},
+		ConfirmQuit: true,
+	}
+}
+
+// Load reads a configuration file on top of the default settings, the keys
+// it binds replacing their default bindings. If the file doesn't exist, the
+// default settings are returned.
+func Load(path string) (*Config, error) {
+	config := Default()
+
+	file, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return config, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	keys := config.Keys
+	config.Keys = nil
+
+	err = json.NewDecoder(file).Decode(config)
+	if err != nil {
+		return nil, err
+	}
+
+	config.Keys = rebind(keys, config.Keys)
+
+	log.Printf("Loaded configuration from '%s'\n", path)
+
+	return config, nil
+}
+
+// GameKeys returns the keys bound to each action for a game.
+func (c *Config) GameKeys(title string) map[string][]string {
+	return rebind(c.Keys, c.Games[title].Keys)
+}
+
+// rebind returns a copy of the keys bound to each action, with the actions
+// of overrides bound to their keys instead. These keys are unbound from the
+// actions they were bound to.
+func rebind(keys, overrides map[string][]string) map[string][]string {
+	bound := func(name string) bool {
+		for _, names := range overrides {
+			for _, other := range names {
+				// SDL key names are case-insensitive.
+				if strings.EqualFold(name, other) {
+					return true
+				}
+			}
+		}
+
+		return false
+	}
+
+	rebound := make(map[string][]string)
+	for action, names := range keys {
+		for _, name := range names {
+			if !bound(name) {
+				rebound[action] = append(rebound[action], name)
+			}
+		}
+	}
+
+	for action, names := range overrides {
+		rebound[action] = names
+	}
+
+	return rebound
+}
+
+// GamePalette returns the name of the palette chosen for a game, if any.
+func (c *Config) GamePalette(title string) string {
+	game, ok := c.Games[title]
+	if ok && game.Palette != "" {
+		return game.Palette
+	}
+
+	return c.Palette
+}
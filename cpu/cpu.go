@@ -1,10 +1,16 @@
 package cpu
 
 import (
+	"encoding/binary"
 	"fmt"
+	"io"
 
+	"github.com/bovarysme/bmo/cartridge"
+	"github.com/bovarysme/bmo/input"
 	"github.com/bovarysme/bmo/interrupt"
 	"github.com/bovarysme/bmo/mmu"
+	"github.com/bovarysme/bmo/model"
+	"github.com/bovarysme/bmo/timer"
 )
 
 // CPU flags' masks
@@ -15,6 +21,9 @@ const (
 	zero
 )
 
+// Approximate duration of a CGB speed switch, in M-cycles
+const speedSwitchCycles = 2050
+
 var cycles = [...]int{
 	1, 3, 2, 2, 1, 1, 2, 1, 5, 2, 2, 2, 1, 1, 2, 1,
 	1, 3, 2, 2, 1, 1, 2, 1, 3, 2, 2, 2, 1, 1, 2, 1,
@@ -88,15 +97,15 @@ func (r *Register) Set(value byte) {
 
 type Memory struct {
 	address uint16
-	mmu     *mmu.MMU
+	cpu     *CPU
 }
 
 func (m *Memory) Get() byte {
-	return m.mmu.ReadByte(m.address)
+	return m.cpu.readByte(m.address)
 }
 
 func (m *Memory) Set(value byte) {
-	m.mmu.WriteByte(m.address, value)
+	m.cpu.writeByte(m.address, value)
 }
 
 type ExtendedOperand interface {
@@ -130,6 +139,12 @@ func (s *StackPointer) Set(value uint16) {
 	*s.sp = value
 }
 
+// Clock advances the rest of the system (i.e. the PPU, the timer and the OAM
+// DMA) alongside the CPU.
+type Clock interface {
+	Tick(cycles int)
+}
+
 type CPU struct {
 	// Registers
 	a byte
@@ -146,17 +161,31 @@ type CPU struct {
 	// Program counter
 	pc uint16
 
-	halted bool
+	halted  bool
+	stopped bool
 	// Interrupt Master Enable flag
 	ime bool
+	// EI enables interrupts after the instruction following it.
+	imePending bool
+	// Set when HALT fails to increment PC (see halt).
+	haltBug bool
 
+	// Duration of the current instruction, and how many of its M-cycles the
+	// rest of the system has already been advanced by
 	cycles int
+	ticks  int
 
 	lastOpcode       byte
 	lastPrefixOpcode byte
 
-	ic  *interrupt.IC
-	mmu *mmu.MMU
+	// Called before executing the instruction at an address, and after
+	// writing to the memory bus (e.g. by scripts), unless nil
+	ExecHook  func(address uint16)
+	WriteHook func(address uint16, value byte)
+
+	clock Clock
+	ic    *interrupt.IC
+	mmu   *mmu.MMU
 }
 
 func NewCPU(mmu *mmu.MMU, ic *interrupt.IC) *CPU {
@@ -166,26 +195,114 @@ func NewCPU(mmu *mmu.MMU, ic *interrupt.IC) *CPU {
 	}
 }
 
+// A, F, B, C, D, E, H and L as left by each model's boot ROM
+var postBootRegisters = map[model.Model][8]byte{
+	model.DMG0: {0x01, 0x00, 0xff, 0x13, 0x00, 0xc1, 0x84, 0x03},
+	model.DMG:  {0x01, 0x80, 0x00, 0x13, 0x00, 0xd8, 0x01, 0x4d},
+	model.MGB:  {0xff, 0x80, 0x00, 0x13, 0x00, 0xd8, 0x01, 0x4d},
+	model.SGB:  {0x01, 0x00, 0x00, 0x14, 0x00, 0x00, 0xc0, 0x60},
+	model.SGB2: {0xff, 0x00, 0x00, 0x14, 0x00, 0x00, 0xc0, 0x60},
+	model.CGB:  {0x11, 0x80, 0x00, 0x00, 0xff, 0x56, 0x00, 0x0d},
+}
+
+// SkipBoot sets the registers to the values left by the model's boot ROM,
+// some of which depend on the cartridge header.
+func (c *CPU) SkipBoot(m model.Model, header *cartridge.Header) {
+	r := postBootRegisters[m]
+	c.a, c.f, c.b, c.c, c.d, c.e, c.h, c.l = r[0], r[1], r[2], r[3], r[4], r[5], r[6], r[7]
+
+	switch {
+	case (m == model.DMG || m == model.MGB) && header.HeaderChecksum != 0:
+		c.f |= halfCarry | carry
+	case m == model.CGB && !header.CGB():
+		// The boot ROM goes on to set up the DMG compatibility mode.
+		c.b = 0
+		if header.Nintendo() {
+			c.b = header.TitleChecksum()
+		}
+		c.d = 0x00
+		c.e = 0x08
+		c.h = 0x00
+		c.l = 0x7c
+	}
+
+	c.sp = 0xfffe
+	c.pc = 0x0100
+}
+
+func (c *CPU) LinkClock(clock Clock) {
+	c.clock = clock
+}
+
 func (c *CPU) String() string {
 	mnemonic := getMnemonic(c.lastOpcode, c.lastPrefixOpcode)
 
 	return fmt.Sprintf("%s\n"+
 		"a: %#02x  f: %#02x  b: %#02x  c: %#02x  d: %#02x  e: %#02x  h: %#02x  l: %#02x\n"+
-		"sp: %#04x  pc: %#04x  halt: %t  ime: %t",
+		"sp: %#04x  pc: %#04x  halt: %t  stop: %t  ime: %t",
 		mnemonic,
 		c.a, c.f, c.b, c.c, c.d, c.e, c.h, c.l,
-		c.sp, c.pc, c.halted, c.ime)
+		c.sp, c.pc, c.halted, c.stopped, c.ime)
+}
+
+// Registers holds the state of the registers and flags, for inspection.
+type Registers struct {
+	A byte `json:"a"`
+	F byte `json:"f"`
+	B byte `json:"b"`
+	C byte `json:"c"`
+	D byte `json:"d"`
+	E byte `json:"e"`
+	H byte `json:"h"`
+	L byte `json:"l"`
+
+	SP uint16 `json:"sp"`
+	PC uint16 `json:"pc"`
+
+	Halted  bool `json:"halted"`
+	Stopped bool `json:"stopped"`
+	IME     bool `json:"ime"`
+}
+
+func (c *CPU) Registers() Registers {
+	return Registers{
+		A: c.a, F: c.f, B: c.b, C: c.c, D: c.d, E: c.e, H: c.h, L: c.l,
+
+		SP: c.sp,
+		PC: c.pc,
+
+		Halted:  c.halted,
+		Stopped: c.stopped,
+		IME:     c.ime,
+	}
 }
 
 func (c *CPU) GetPC() uint16 {
 	return c.pc
 }
 
+// Step executes one instruction (or handles an interrupt), advancing the rest
+// of the system on each of its memory accesses.
 func (c *CPU) Step() (int, error) {
 	c.cycles = 0
+	c.ticks = 0
+
+	defer c.tickRemaining()
+
+	// While in STOP mode, wait for a selected joypad input to go low.
+	if c.stopped {
+		if c.mmu.ReadByte(input.P1)&0xf == 0xf {
+			c.cycles = 1
+			return c.cycles, nil
+		}
+
+		c.stopped = false
+	}
+
+	enableIME := c.imePending
 
 	if c.halted || c.ime {
-		interrupted, kind := c.ic.Check()
+		interrupted, _ := c.ic.Check()
 
 		// While in HALT mode, if an interrupt is enabled and requested exit
 		// HALT mode and continue execution (either by handling the interrupt
@@ -193,41 +310,109 @@ func (c *CPU) Step() (int, error) {
 		if c.halted && interrupted {
 			c.halted = false
 		} else if c.halted && !interrupted {
-			return 1, nil
+			c.cycles = 1
+			return c.cycles, nil
 		}
 
 		if c.ime && interrupted {
-			c.ime = false
-
-			c.ic.Clear(1 << byte(kind))
-
-			c.pushStack(c.pc)
-			c.pc = 0x40 + uint16(kind)*8
-
-			c.cycles += 5
+			c.dispatch()
 
 			return c.cycles, nil
 		}
 	}
 
+	if c.ExecHook != nil {
+		c.ExecHook(c.pc)
+	}
+
 	opcode := c.fetch()
 	err := c.decode(opcode)
 
+	// Unless the instruction was DI, enable interrupts if the previous
+	// instruction was EI.
+	if enableIME && c.imePending {
+		c.ime = true
+		c.imePending = false
+	}
+
 	return c.cycles, err
 }
 
+// dispatch calls an interrupt handler in 5 M-cycles: 2 wait cycles, 2 cycles
+// pushing PC and 1 cycle setting PC.
+func (c *CPU) dispatch() {
+	c.ime = false
+	c.cycles += 5
+
+	c.tick()
+	c.tick()
+
+	c.sp--
+	c.writeByte(c.sp, byte(c.pc>>8))
+
+	// The interrupt is only chosen after the high byte of PC has been pushed,
+	// which may have overwritten IE. If no interrupt remains, PC is set to 0.
+	interrupted, kind := c.ic.Check()
+
+	c.sp--
+	c.writeByte(c.sp, byte(c.pc&0xff))
+
+	if interrupted {
+		c.ic.Clear(1 << byte(kind))
+		c.pc = 0x40 + uint16(kind)*8
+	} else {
+		c.pc = 0
+	}
+}
+
+// tick advances the rest of the system by one M-cycle.
+func (c *CPU) tick() {
+	c.ticks++
+	c.clock.Tick(1)
+}
+
+// tickRemaining advances the rest of the system by the internal M-cycles of
+// the current instruction which haven't been accounted for yet.
+func (c *CPU) tickRemaining() {
+	if c.ticks < c.cycles {
+		c.clock.Tick(c.cycles - c.ticks)
+		c.ticks = c.cycles
+	}
+}
+
+func (c *CPU) readByte(address uint16) byte {
+	value := c.mmu.ReadByte(address)
+	c.tick()
+
+	return value
+}
+
+func (c *CPU) writeByte(address uint16, value byte) {
+	c.mmu.WriteByte(address, value)
+	if c.WriteHook != nil {
+		c.WriteHook(address, value)
+	}
+
+	c.tick()
+}
+
 func (c *CPU) fetch() byte {
-	value := c.mmu.ReadByte(c.pc)
-	c.pc++
+	value := c.readByte(c.pc)
+
+	if c.haltBug {
+		c.haltBug = false
+	} else {
+		c.pc++
+	}
 
 	return value
 }
 
 func (c *CPU) fetchWord() uint16 {
-	value := c.mmu.ReadWord(c.pc)
-	c.pc += 2
+	low := c.fetch()
+	high := c.fetch()
 
-	return value
+	return uint16(high)<<8 | uint16(low)
 }
 
 func (c *CPU) decode(opcode byte) error {
@@ -438,15 +623,23 @@ func (c *CPU) decodePrefix() error {
 }
 
 func (c *CPU) popStack() uint16 {
-	value := c.mmu.ReadWord(c.sp)
-	c.sp += 2
+	low := c.readByte(c.sp)
+	c.sp++
+	high := c.readByte(c.sp)
+	c.sp++
 
-	return value
+	return uint16(high)<<8 | uint16(low)
 }
 
+// pushStack pushes a value after an internal M-cycle, which all the
+// instructions pushing to the stack have.
 func (c *CPU) pushStack(value uint16) {
-	c.sp -= 2
-	c.mmu.WriteWord(c.sp, value)
+	c.tick()
+
+	c.sp--
+	c.writeByte(c.sp, byte(value>>8))
+	c.sp--
+	c.writeByte(c.sp, byte(value&0xff))
 }
 
 func (c *CPU) decodeAddress(opcode byte) uint16 {
@@ -541,7 +734,7 @@ func (c *CPU) getOperand(register *byte) Operand {
 	address := c.getHL()
 	return &Memory{
 		address: address,
-		mmu:     c.mmu,
+		cpu:     c,
 	}
 }
 
@@ -582,7 +775,7 @@ func (c *CPU) getSourceValue(opcode byte) byte {
 
 	// Else the instruction has a (HL) source operand.
 	address := c.getHL()
-	return c.mmu.ReadByte(address)
+	return c.readByte(address)
 }
 
 func (c *CPU) hasFlags(mask byte) bool {
@@ -617,7 +810,7 @@ func (c *CPU) ld16(operand ExtendedOperand) {
 
 func (c *CPU) str16(operand ExtendedOperand) {
 	address := operand.Get()
-	c.mmu.WriteByte(address, c.a)
+	c.writeByte(address, c.a)
 }
 
 func (c *CPU) inc16(operand ExtendedOperand) {
@@ -672,7 +865,8 @@ func (c *CPU) rlca() {
 
 func (c *CPU) stspa16() {
 	address := c.fetchWord()
-	c.mmu.WriteWord(address, c.sp)
+	c.writeByte(address, byte(c.sp&0xff))
+	c.writeByte(address+1, byte(c.sp>>8))
 }
 
 func (c *CPU) add16(operand ExtendedOperand) {
@@ -695,7 +889,7 @@ func (c *CPU) add16(operand ExtendedOperand) {
 
 func (c *CPU) ldr16(operand ExtendedOperand) {
 	address := operand.Get()
-	c.a = c.mmu.ReadByte(address)
+	c.a = c.readByte(address)
 }
 
 func (c *CPU) dec16(operand ExtendedOperand) {
@@ -715,8 +909,20 @@ func (c *CPU) rrca() {
 	}
 }
 
+// stop enters STOP mode, in which the system clock is halted until a joypad
+// input goes low. On the CGB, it switches the CPU speed instead if a switch
+// has been prepared through KEY1. DIV is reset in both cases.
 func (c *CPU) stop() {
 	c.fetch()
+
+	c.mmu.WriteByte(timer.DIV, 0)
+
+	if c.mmu.SwitchSpeed() {
+		c.cycles += speedSwitchCycles
+		return
+	}
+
+	c.stopped = true
 }
 
 func (c *CPU) rla() {
@@ -757,7 +963,7 @@ func (c *CPU) jrc(condition bool) {
 
 func (c *CPU) sti() {
 	address := c.getHL()
-	c.mmu.WriteByte(address, c.a)
+	c.writeByte(address, c.a)
 
 	address++
 
@@ -803,7 +1009,7 @@ func (c *CPU) daa() {
 
 func (c *CPU) ldi() {
 	address := c.getHL()
-	c.a = c.mmu.ReadByte(address)
+	c.a = c.readByte(address)
 
 	address++
 
@@ -819,7 +1025,7 @@ func (c *CPU) cpl() {
 
 func (c *CPU) std() {
 	address := c.getHL()
-	c.mmu.WriteByte(address, c.a)
+	c.writeByte(address, c.a)
 
 	address--
 
@@ -834,7 +1040,7 @@ func (c *CPU) scf() {
 
 func (c *CPU) ldd() {
 	address := c.getHL()
-	c.a = c.mmu.ReadByte(address)
+	c.a = c.readByte(address)
 
 	address--
 
@@ -847,8 +1053,21 @@ func (c *CPU) ccf() {
 	c.f ^= carry
 }
 
+// halt enters HALT mode until an interrupt is requested. If interrupts are
+// disabled and one is already pending, HALT mode isn't entered and the next
+// byte is read twice (the HALT bug). Right after EI, the pending interrupt is
+// handled instead, returning to the HALT instruction which is executed again.
 func (c *CPU) halt() {
-	c.halted = true
+	pending, _ := c.ic.Check()
+
+	switch {
+	case c.imePending && pending:
+		c.pc--
+	case !c.ime && pending:
+		c.haltBug = true
+	default:
+		c.halted = true
+	}
 }
 
 func (c *CPU) add(value byte) {
@@ -977,6 +1196,9 @@ func (c *CPU) cp(value byte) {
 }
 
 func (c *CPU) retc(condition bool) {
+	// The condition is checked during an internal M-cycle.
+	c.tick()
+
 	if condition {
 		c.cycles += 3
 		c.pc = c.popStack()
@@ -1045,12 +1267,12 @@ func (c *CPU) reti() {
 
 func (c *CPU) sta8() {
 	address := 0xff00 + uint16(c.fetch())
-	c.mmu.WriteByte(address, c.a)
+	c.writeByte(address, c.a)
 }
 
 func (c *CPU) stc() {
 	address := 0xff00 + uint16(c.c)
-	c.mmu.WriteByte(address, c.a)
+	c.writeByte(address, c.a)
 }
 
 func (c *CPU) addspr8() {
@@ -1074,21 +1296,22 @@ func (c *CPU) jphl() {
 
 func (c *CPU) sta16() {
 	address := c.fetchWord()
-	c.mmu.WriteByte(address, c.a)
+	c.writeByte(address, c.a)
 }
 
 func (c *CPU) lda8() {
 	address := 0xff00 + uint16(c.fetch())
-	c.a = c.mmu.ReadByte(address)
+	c.a = c.readByte(address)
 }
 
 func (c *CPU) ldc() {
 	address := 0xff00 + uint16(c.c)
-	c.a = c.mmu.ReadByte(address)
+	c.a = c.readByte(address)
 }
 
 func (c *CPU) di() {
 	c.ime = false
+	c.imePending = false
 }
 
 func (c *CPU) stspr8() {
@@ -1112,11 +1335,13 @@ func (c *CPU) ldsp() {
 
 func (c *CPU) lda16() {
 	address := c.fetchWord()
-	c.a = c.mmu.ReadByte(address)
+	c.a = c.readByte(address)
 }
 
 func (c *CPU) ei() {
-	c.ime = true
+	if !c.ime {
+		c.imePending = true
+	}
 }
 
 func (c *CPU) rlc(operand Operand) {
@@ -1283,3 +1508,76 @@ func (c *CPU) set(operand Operand, bit byte) {
 	value := operand.Get() | 1<<bit
 	operand.Set(value)
 }
+
+type cpuState struct {
+	A  byte
+	F  byte
+	B  byte
+	C  byte
+	D  byte
+	E  byte
+	H  byte
+	L  byte
+	SP uint16
+	PC uint16
+
+	Halted     bool
+	Stopped    bool
+	IME        bool
+	IMEPending bool
+	HaltBug    bool
+
+	LastOpcode       byte
+	LastPrefixOpcode byte
+}
+
+func (c *CPU) SaveState(w io.Writer) error {
+	state := cpuState{
+		A:  c.a,
+		F:  c.f,
+		B:  c.b,
+		C:  c.c,
+		D:  c.d,
+		E:  c.e,
+		H:  c.h,
+		L:  c.l,
+		SP: c.sp,
+		PC: c.pc,
+
+		Halted:     c.halted,
+		Stopped:    c.stopped,
+		IME:        c.ime,
+		IMEPending: c.imePending,
+		HaltBug:    c.haltBug,
+
+		LastOpcode:       c.lastOpcode,
+		LastPrefixOpcode: c.lastPrefixOpcode,
+	}
+
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (c *CPU) LoadState(r io.Reader) error {
+	var state cpuState
+
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+
+	c.a, c.f, c.b, c.c = state.A, state.F, state.B, state.C
+	c.d, c.e, c.h, c.l = state.D, state.E, state.H, state.L
+	c.sp = state.SP
+	c.pc = state.PC
+
+	c.halted = state.Halted
+	c.stopped = state.Stopped
+	c.ime = state.IME
+	c.imePending = state.IMEPending
+	c.haltBug = state.HaltBug
+
+	c.lastOpcode = state.LastOpcode
+	c.lastPrefixOpcode = state.LastPrefixOpcode
+
+	return nil
+}
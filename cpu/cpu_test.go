@@ -0,0 +1,171 @@
+package cpu
+
+import (
+	"testing"
+
+	"github.com/bovarysme/bmo/interrupt"
+	"github.com/bovarysme/bmo/mmu"
+	"github.com/bovarysme/bmo/model"
+)
+
+const (
+	programStart = 0xc000
+	stackStart   = 0xdff0
+)
+
+// Opcodes used by the test programs
+const (
+	nop  = 0x00
+	incA = 0x3c
+	halt = 0x76
+	di   = 0xf3
+	ei   = 0xfb
+)
+
+type testClock struct{}
+
+func (c *testClock) Tick(cycles int) {}
+
+// newTestCPU returns a CPU about to run a program from the work RAM, with the
+// VBlank interrupt enabled.
+func newTestCPU(t *testing.T, program []byte) (*CPU, *interrupt.IC) {
+	m, err := mmu.NewMMU("", model.DMG, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ic := interrupt.NewIC()
+	ic.WriteByte(interrupt.IE, interrupt.VBlank)
+	m.LinkIC(ic)
+
+	for i, value := range program {
+		m.WriteByte(programStart+uint16(i), value)
+	}
+
+	c := NewCPU(m, ic)
+	c.LinkClock(&testClock{})
+	c.pc = programStart
+	c.sp = stackStart
+
+	return c, ic
+}
+
+func TestHalt(t *testing.T) {
+	tests := []struct {
+		name    string
+		program []byte
+		ime     bool
+		// The VBlank interrupt is requested before the first step.
+		pending bool
+		steps   int
+
+		wantPC     uint16
+		wantA      byte
+		wantHalted bool
+		// Address pushed by the interrupt dispatch, if any
+		wantReturn uint16
+	}{
+		{
+			name:    "HALT without a pending interrupt",
+			program: []byte{halt, incA},
+			steps:   3,
+
+			wantPC:     programStart + 1,
+			wantHalted: true,
+		},
+		{
+			name:    "HALT bug",
+			program: []byte{halt, incA, nop},
+			pending: true,
+			steps:   2,
+
+			// The byte following HALT is read twice.
+			wantPC: programStart + 1,
+			wantA:  1,
+		},
+		{
+			name:    "HALT bug, then the next instruction",
+			program: []byte{halt, incA, nop},
+			pending: true,
+			steps:   3,
+
+			wantPC: programStart + 2,
+			wantA:  2,
+		},
+		{
+			name:    "HALT with IME and a pending interrupt",
+			program: []byte{halt, incA},
+			ime:     true,
+			pending: true,
+			steps:   1,
+
+			// The interrupt is dispatched before HALT is executed.
+			wantPC:     0x40,
+			wantReturn: programStart,
+		},
+		{
+			name:    "EI, HALT without a pending interrupt",
+			program: []byte{ei, halt, incA},
+			steps:   3,
+
+			wantPC:     programStart + 2,
+			wantHalted: true,
+		},
+		{
+			name:    "EI, HALT with a pending interrupt",
+			program: []byte{ei, halt, incA},
+			pending: true,
+			steps:   3,
+
+			// The interrupt returns to HALT rather than past it.
+			wantPC:     0x40,
+			wantReturn: programStart + 1,
+		},
+		{
+			name:    "EI, DI, HALT with a pending interrupt",
+			program: []byte{ei, di, halt, incA},
+			pending: true,
+			steps:   4,
+
+			// DI cancels EI, so HALT triggers the HALT bug.
+			wantPC: programStart + 3,
+			wantA:  1,
+		},
+	}
+
+	for _, test := range tests {
+		c, ic := newTestCPU(t, test.program)
+		c.ime = test.ime
+		if test.pending {
+			ic.Request(interrupt.VBlank)
+		}
+
+		for i := 0; i < test.steps; i++ {
+			_, err := c.Step()
+			if err != nil {
+				t.Fatalf("%s: %s", test.name, err)
+			}
+		}
+
+		if c.pc != test.wantPC {
+			t.Errorf("%s: PC is %#04x, want %#04x", test.name, c.pc, test.wantPC)
+		}
+
+		if c.a != test.wantA {
+			t.Errorf("%s: A is %d, want %d", test.name, c.a, test.wantA)
+		}
+
+		if c.halted != test.wantHalted {
+			t.Errorf("%s: halted is %t, want %t", test.name, c.halted, test.wantHalted)
+		}
+
+		if test.wantReturn == 0 {
+			continue
+		}
+
+		returnAddress := uint16(c.mmu.ReadByte(c.sp+1))<<8 | uint16(c.mmu.ReadByte(c.sp))
+		if c.sp != stackStart-2 || returnAddress != test.wantReturn {
+			t.Errorf("%s: returns to %#04x, want %#04x", test.name, returnAddress, test.wantReturn)
+		}
+	}
+}
@@ -18,6 +18,8 @@ type Debugger struct {
 
 	breaking   bool
 	breakpoint uint16
+
+	search *search
 }
 
 func NewDebugger(bmo *beemo.BMO) *Debugger {
@@ -103,6 +105,34 @@ func (d *Debugger) execute(command string, args []string) error {
 		if err != nil {
 			return err
 		}
+	} else if command == "f" || command == "frame" {
+		frames := 1
+		if len(args) > 0 {
+			n, err := strconv.Atoi(args[0])
+			if err != nil || n < 1 {
+				fmt.Println("Invalid number of frames.")
+				return nil
+			}
+
+			frames = n
+		}
+
+		err := d.bmo.RunFrames(frames)
+		if err != nil {
+			return err
+		}
+	} else if command == "search" {
+		d.executeSearch(args)
+	} else if command == "reset" {
+		err := d.bmo.SoftReset()
+		if err != nil {
+			fmt.Println(err)
+		}
+	} else if command == "hardreset" {
+		err := d.bmo.HardReset()
+		if err != nil {
+			fmt.Println(err)
+		}
 	} else if command == "q" || command == "quit" {
 		d.running = false
 		fmt.Print("Goodbye!")
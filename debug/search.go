@@ -0,0 +1,200 @@
+package debug
+
+import (
+	"fmt"
+	"strconv"
+)
+
+const (
+	wramStart = 0xc000
+	wramEnd   = 0xdfff
+	hramStart = 0xff80
+	hramEnd   = 0xfffe
+
+	externalRAMStart = 0xa000
+)
+
+// Maximum number of addresses printed by "search list"
+const maxListed = 64
+
+// location is an address on the memory bus or, for the external RAM, an
+// address within one of its banks.
+type location struct {
+	external bool
+	bank     int
+	address  uint16
+}
+
+func (l location) String() string {
+	if l.external {
+		return fmt.Sprintf("%02x:%#04x", l.bank, l.address)
+	}
+
+	return fmt.Sprintf("%#04x", l.address)
+}
+
+type candidate struct {
+	location location
+	// Value found by the previous snapshot
+	value uint16
+}
+
+// search narrows down the addresses holding a value, by comparing snapshots
+// of WRAM, HRAM and the external RAM.
+type search struct {
+	// Size of the values, in bytes
+	size       int
+	candidates []candidate
+}
+
+func (d *Debugger) readByte(l location) byte {
+	if !l.external {
+		return d.bmo.PeekByte(l.address)
+	}
+
+	ram := d.bmo.CartridgeRAM()
+	offset := int(l.address - externalRAMStart)
+	if l.bank >= len(ram) || offset >= len(ram[l.bank]) {
+		return 0xff
+	}
+
+	return ram[l.bank][offset]
+}
+
+// read reads a little-endian value of the search's size.
+func (d *Debugger) read(l location) uint16 {
+	value := uint16(d.readByte(l))
+	if d.search.size == 2 {
+		l.address++
+		value |= uint16(d.readByte(l)) << 8
+	}
+
+	return value
+}
+
+func (d *Debugger) startSearch(size int) {
+	d.search = &search{size: size}
+
+	add := func(l location) {
+		d.search.candidates = append(d.search.candidates, candidate{
+			location: l,
+			value:    d.read(l),
+		})
+	}
+
+	// Values can't straddle the end of a region.
+	last := uint16(size - 1)
+
+	for address := uint16(wramStart); address <= wramEnd-last; address++ {
+		add(location{address: address})
+	}
+
+	for address := uint16(hramStart); address <= hramEnd-last; address++ {
+		add(location{address: address})
+	}
+
+	for bank, data := range d.bmo.CartridgeRAM() {
+		for offset := 0; offset < len(data)-int(last); offset++ {
+			add(location{
+				external: true,
+				bank:     bank,
+				address:  uint16(externalRAMStart + offset),
+			})
+		}
+	}
+}
+
+// filterSearch keeps the candidates whose value matches the comparison, and
+// updates their value.
+func (d *Debugger) filterSearch(match func(previous, current uint16) bool) {
+	candidates := d.search.candidates[:0]
+
+	for _, c := range d.search.candidates {
+		current := d.read(c.location)
+		if match(c.value, current) {
+			c.value = current
+			candidates = append(candidates, c)
+		}
+	}
+
+	d.search.candidates = candidates
+}
+
+func (d *Debugger) listSearch() {
+	for i, c := range d.search.candidates {
+		if i == maxListed {
+			fmt.Printf("... and %d more.\n", len(d.search.candidates)-maxListed)
+			break
+		}
+
+		fmt.Printf("%s: %d (%#x)\n", c.location, c.value, c.value)
+	}
+}
+
+func (d *Debugger) executeSearch(args []string) {
+	if len(args) < 1 {
+		fmt.Println("Usage: search start [8|16], search eq|ne|inc|dec|is <value>|list")
+		return
+	}
+
+	if args[0] == "start" {
+		size := 1
+		if len(args) > 1 && args[1] == "16" {
+			size = 2
+		} else if len(args) > 1 && args[1] != "8" {
+			fmt.Println("Values are either 8 or 16 bits wide.")
+			return
+		}
+
+		d.startSearch(size)
+		fmt.Printf("Search started: %d candidates.\n", len(d.search.candidates))
+		return
+	}
+
+	if d.search == nil {
+		fmt.Println("You must start a search first.")
+		return
+	}
+
+	switch args[0] {
+	case "eq":
+		d.filterSearch(func(previous, current uint16) bool {
+			return current == previous
+		})
+	case "ne":
+		d.filterSearch(func(previous, current uint16) bool {
+			return current != previous
+		})
+	case "inc":
+		d.filterSearch(func(previous, current uint16) bool {
+			return current > previous
+		})
+	case "dec":
+		d.filterSearch(func(previous, current uint16) bool {
+			return current < previous
+		})
+	case "is":
+		if len(args) < 2 {
+			fmt.Println("You must specify a value.")
+			return
+		}
+
+		value, err := strconv.ParseUint(args[1], 0, 8*d.search.size)
+		if err != nil {
+			fmt.Println("Invalid value.")
+			return
+		}
+
+		d.filterSearch(func(previous, current uint16) bool {
+			return current == uint16(value)
+		})
+	case "list":
+		d.listSearch()
+		return
+	default:
+		fmt.Println("Unknown search command.")
+		return
+	}
+
+	fmt.Printf("%d candidates left.\n", len(d.search.candidates))
+}
@@ -0,0 +1,236 @@
+package env
+
+import (
+	"errors"
+
+	"github.com/bovarysme/bmo/beemo"
+	"github.com/bovarysme/bmo/input"
+	"github.com/bovarysme/bmo/model"
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// RAM regions included in the RAM snapshots
+const (
+	wramStart = 0xc000
+	wramEnd   = 0xdfff
+	hramStart = 0xff80
+	hramEnd   = 0xfffe
+)
+
+// RAMSize is the size of the RAM snapshots: WRAM followed by HRAM.
+const RAMSize = wramEnd - wramStart + 1 + hramEnd - hramStart + 1
+
+// Action holds the buttons held during a step, bit n being set if button n
+// (e.g. input.Start) is pressed.
+type Action byte
+
+// Press returns the action with a button pressed as well.
+func (a Action) Press(button byte) Action {
+	return a | 1<<button
+}
+
+type Options struct {
+	Model model.Model
+	// Path to a boot ROM, the emulation starting from the post-boot state if
+	// empty
+	BootromPath string
+	ROMPath     string
+
+	// FrameSkip is the number of frames each action is held for (1 if 0).
+	FrameSkip int
+	// Downsample divides the observations' size, by averaging blocks of
+	// pixels (1 if 0). It has to divide both 160 and 144, e.g. 2 or 4.
+	Downsample int
+	// RAM adds a RAM snapshot to the info returned by each step.
+	RAM bool
+}
+
+type Info struct {
+	// Number of frames emulated since the last reset
+	Frames int
+	// Only set with Options.RAM
+	RAM []byte
+}
+
+// Env is a reinforcement learning environment over the emulator, which runs
+// headless and as fast as possible. Environments are independent, so many of
+// them can run in parallel goroutines, but each of them must only be used by
+// one goroutine at a time. The package depends neither on SDL nor on the web
+// frontend, which the main package injects into the emulator.
+type Env struct {
+	bmo     *beemo.BMO
+	options Options
+
+	// Snapshot of the power-on state, restored by Reset
+	initial State
+
+	frames      int
+	observation []byte
+}
+
+// State is a copy of an environment's state, which can be restored any
+// number of times (e.g. for tree searches).
+type State struct {
+	snapshot    []byte
+	frames      int
+	observation []byte
+}
+
+func NewEnv(options Options) (*Env, error) {
+	if options.FrameSkip == 0 {
+		options.FrameSkip = 1
+	}
+
+	if options.Downsample == 0 {
+		options.Downsample = 1
+	}
+
+	if options.FrameSkip < 0 {
+		return nil, errors.New("Invalid frame skip")
+	}
+
+	d := options.Downsample
+	if d < 1 || ppu.ScreenWidth%d != 0 || ppu.ScreenHeight%d != 0 {
+		return nil, errors.New("Invalid downsampling factor")
+	}
+
+	bmo, err := beemo.NewBMO(beemo.Options{
+		Model:       options.Model,
+		BootromPath: options.BootromPath,
+		ROMPath:     options.ROMPath,
+		Headless:    true,
+		Uncapped:    true,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	width, height := options.ObservationSize()
+	e := &Env{
+		bmo:     bmo,
+		options: options,
+
+		observation: make([]byte, width*height),
+	}
+
+	e.observe()
+
+	e.initial, err = e.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// ObservationSize returns the width and height of the observations.
+func (o Options) ObservationSize() (int, int) {
+	return ppu.ScreenWidth / o.Downsample, ppu.ScreenHeight / o.Downsample
+}
+
+// Reset powers the system on again, and returns the first observation.
+func (e *Env) Reset() ([]byte, error) {
+	err := e.Restore(e.initial)
+	if err != nil {
+		return nil, err
+	}
+
+	return e.Observation(), nil
+}
+
+// Step holds the action's buttons for the frame skip's number of frames, and
+// returns the last frame's observation.
+func (e *Env) Step(action Action) ([]byte, Info, error) {
+	for button := input.Right; button <= input.Start; button++ {
+		e.bmo.SetButton(button, action&(1<<button) != 0)
+	}
+
+	err := e.bmo.RunFrames(e.options.FrameSkip)
+	if err != nil {
+		return nil, Info{}, err
+	}
+
+	e.frames += e.options.FrameSkip
+	e.observe()
+
+	info := Info{Frames: e.frames}
+	if e.options.RAM {
+		info.RAM = e.RAM()
+	}
+
+	return e.Observation(), info, nil
+}
+
+// Observation returns a copy of the last observation: the frame's pixels in
+// grayscale (0 being black), row by row.
+func (e *Env) Observation() []byte {
+	observation := make([]byte, len(e.observation))
+	copy(observation, e.observation)
+
+	return observation
+}
+
+// observe computes the observation of the last frame, from its shades rather
+// than from its colors so that it doesn't depend on the palette.
+func (e *Env) observe() {
+	shades := e.bmo.Shades()
+	d := e.options.Downsample
+	width, height := e.options.ObservationSize()
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			sum := 0
+			for j := 0; j < d; j++ {
+				for i := 0; i < d; i++ {
+					shade := shades[(y*d+j)*ppu.ScreenWidth+x*d+i]
+					sum += 255 - int(shade)*85
+				}
+			}
+
+			e.observation[y*width+x] = byte(sum / (d * d))
+		}
+	}
+}
+
+// RAM returns a snapshot of WRAM and HRAM.
+func (e *Env) RAM() []byte {
+	ram := make([]byte, 0, RAMSize)
+
+	for address := wramStart; address <= wramEnd; address++ {
+		ram = append(ram, e.bmo.PeekByte(uint16(address)))
+	}
+
+	for address := hramStart; address <= hramEnd; address++ {
+		ram = append(ram, e.bmo.PeekByte(uint16(address)))
+	}
+
+	return ram
+}
+
+// Clone copies the environment's state.
+func (e *Env) Clone() (State, error) {
+	snapshot, err := e.bmo.Snapshot()
+	if err != nil {
+		return State{}, err
+	}
+
+	return State{
+		snapshot:    snapshot,
+		frames:      e.frames,
+		observation: e.Observation(),
+	}, nil
+}
+
+// Restore restores a state copied from this environment (or from one created
+// with the same options).
+func (e *Env) Restore(state State) error {
+	err := e.bmo.Restore(state.snapshot)
+	if err != nil {
+		return err
+	}
+
+	e.frames = state.frames
+	copy(e.observation, state.observation)
+
+	return nil
+}
@@ -0,0 +1,135 @@
+package input
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Joypad buttons which can be bound to keys
+var buttons = map[string]byte{
+	"right":  Right,
+	"left":   Left,
+	"up":     Up,
+	"down":   Down,
+	"a":      A,
+	"b":      B,
+	"select": Select,
+	"start":  Start,
+}
+
+// Events triggered by the hotkeys when pressed and released
+var hotkeys = map[string][2]Event{
+	"quit":          {RequestQuit, None},
+	"pause":         {Pause, None},
+	"frame_advance": {FrameAdvance, None},
+	"reset":         {Reset, None},
+	"hard_reset":    {HardReset, None},
+	"save_state":    {SaveState, None},
+	"load_state":    {LoadState, None},
+	"fast_forward":  {FastForwardPressed, FastForwardReleased},
+	"slow_motion":   {SlowMotionPressed, SlowMotionReleased},
+	"rewind":        {RewindPressed, RewindReleased},
+	"fullscreen":    {ToggleFullscreen, None},
+	"screenshot":    {Screenshot, None},
+	"record":        {ToggleRecording, None},
+}
+
+// ParseButton returns the joypad button with the given name (e.g. "start").
+func ParseButton(name string) (byte, error) {
+	button, ok := buttons[name]
+	if !ok {
+		return 0, fmt.Errorf("Unknown button: %s", name)
+	}
+
+	return button, nil
+}
+
+type binding struct {
+	action string
+
+	isButton bool
+	button   byte
+
+	pressed  Event
+	released Event
+}
+
+// Bindings maps keys, by their lowercased SDL names, to joypad buttons and
+// hotkeys.
+type Bindings map[string]binding
+
+// NewBindings binds keys, given by their SDL names, to actions.
+func NewBindings(keys map[string][]string) (Bindings, error) {
+	bindings := make(Bindings)
+
+	for action, names := range keys {
+		b := binding{action: action}
+
+		if button, ok := buttons[action]; ok {
+			b.isButton = true
+			b.button = button
+		} else if events, ok := hotkeys[action]; ok {
+			b.pressed, b.released = events[0], events[1]
+		} else {
+			return nil, fmt.Errorf("Unknown action: %s", action)
+		}
+
+		for _, name := range names {
+			key := strings.ToLower(name)
+			if !keyNames[key] {
+				return nil, fmt.Errorf("Unknown key: %s", name)
+			}
+
+			other, ok := bindings[key]
+			if ok {
+				return nil, fmt.Errorf("Key %s is bound to both %s and %s", name, other.action, action)
+			}
+
+			bindings[key] = b
+		}
+	}
+
+	return bindings, nil
+}
+
+// Bound returns whether a key is bound to an action.
+func (b Bindings) Bound(name string) bool {
+	_, ok := b[strings.ToLower(name)]
+	return ok
+}
+
+// Press presses the button bound to a key, or returns the event triggered
+// by the hotkey bound to it. Repeated presses only keep buttons pressed.
+func (b Bindings) Press(joypad *Joypad, name string, repeat bool) Event {
+	binding, ok := b[strings.ToLower(name)]
+	if !ok {
+		return None
+	}
+
+	if binding.isButton {
+		joypad.SetKey(binding.button)
+		return None
+	}
+
+	if repeat {
+		return None
+	}
+
+	return binding.pressed
+}
+
+// Release releases the button bound to a key, or returns the event
+// triggered by the hotkey bound to it.
+func (b Bindings) Release(joypad *Joypad, name string) Event {
+	binding, ok := b[strings.ToLower(name)]
+	if !ok {
+		return None
+	}
+
+	if binding.isButton {
+		joypad.ResetKey(binding.button)
+		return None
+	}
+
+	return binding.released
+}
@@ -1,6 +1,9 @@
 package input
 
 import (
+	"encoding/binary"
+	"io"
+
 	"github.com/bovarysme/bmo/interrupt"
 )
 
@@ -22,8 +25,17 @@ const (
 	selectButtonKeys
 )
 
+// SGBPort is implemented by the Super Game Boy, which receives its command
+// packets through P1 and can have several joypads plugged in.
+type SGBPort interface {
+	WriteP1(value byte)
+	// Player returns the selected joypad, 0 being the first one.
+	Player() byte
+}
+
 type Joypad struct {
-	ic *interrupt.IC
+	ic  *interrupt.IC
+	sgb SGBPort
 
 	p1 byte
 
@@ -40,36 +52,79 @@ func NewJoypad(ic *interrupt.IC) *Joypad {
 	}
 }
 
+func (j *Joypad) LinkSGB(sgb SGBPort) {
+	j.sgb = sgb
+}
+
 func (j *Joypad) ReadByte(address uint16) byte {
 	if address != P1 {
 		return 0
 	}
 
+	var player byte
+	if j.sgb != nil {
+		player = j.sgb.Player()
+	}
+
+	// Only the first joypad is connected to the keys. With a Super Game Boy,
+	// the selected joypad is identified when no keys are selected. Reads
+	// don't change the joypad's state, so that they can be peeked.
+	value := j.p1 &^ 0xf
+
 	selected := j.getSelected()
-	if selected != nil {
-		j.p1 &^= 0xf
-		j.p1 |= *selected
+	if selected == nil {
+		value |= 0xf - player
+	} else if player == 0 {
+		value |= *selected
+	} else {
+		value |= 0xf
 	}
 
-	return j.p1
+	return value
 }
 
 func (j *Joypad) WriteByte(address uint16, value byte) {
 	if address == P1 {
 		j.p1 = value & 0x30
+
+		if j.sgb != nil {
+			j.sgb.WriteP1(j.p1)
+		}
 	}
 }
 
+// SetKey presses a key. The joypad interrupt is requested on the high to low
+// transition of an input.
 func (j *Joypad) SetKey(mask byte) {
 	state := j.getState(mask)
 	*state &^= 1 << (mask % 4)
+
+	j.ic.Request(interrupt.Joypad)
 }
 
 func (j *Joypad) ResetKey(mask byte) {
 	state := j.getState(mask)
 	*state |= 1 << (mask % 4)
+}
 
-	j.ic.Request(interrupt.Joypad)
+// State returns the pressed keys, bit n being set if key n is pressed.
+func (j *Joypad) State() byte {
+	return ^(j.buttonKeysState<<4 | j.directionKeysState&0xf)
+}
+
+// SetState presses and releases keys to match a state returned by State.
+func (j *Joypad) SetState(state byte) {
+	pressed := j.State()
+
+	for key := Right; key <= Start; key++ {
+		var mask byte = 1 << key
+
+		if state&mask != 0 && pressed&mask == 0 {
+			j.SetKey(key)
+		} else if state&mask == 0 && pressed&mask != 0 {
+			j.ResetKey(key)
+		}
+	}
 }
 
 func (j *Joypad) getSelected() *byte {
@@ -95,3 +150,34 @@ func (j *Joypad) getState(mask byte) *byte {
 
 	return state
 }
+
+type joypadState struct {
+	P1                 byte
+	DirectionKeysState byte
+	ButtonKeysState    byte
+}
+
+func (j *Joypad) SaveState(w io.Writer) error {
+	state := joypadState{
+		P1:                 j.p1,
+		DirectionKeysState: j.directionKeysState,
+		ButtonKeysState:    j.buttonKeysState,
+	}
+
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (j *Joypad) LoadState(r io.Reader) error {
+	var state joypadState
+
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+
+	j.p1 = state.P1
+	j.directionKeysState = state.DirectionKeysState
+	j.buttonKeysState = state.ButtonKeysState
+
+	return nil
+}
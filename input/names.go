@@ -0,0 +1,40 @@
+package input
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Names of the SDL keys which can be bound, lowercased since SDL key names
+// are case-insensitive
+var keyNames = make(map[string]bool)
+
+func init() {
+	names := []string{
+		"Return", "Escape", "Backspace", "Tab", "Space",
+		"'", ",", "-", ".", "/", ";", "=", "[", "\\", "]", "`",
+		"CapsLock", "PrintScreen", "ScrollLock", "Pause", "Insert", "Home",
+		"PageUp", "Delete", "End", "PageDown",
+		"Right", "Left", "Down", "Up",
+		"Numlock", "Keypad /", "Keypad *", "Keypad -", "Keypad +",
+		"Keypad Enter", "Keypad .", "Application", "Menu",
+		"Left Ctrl", "Left Shift", "Left Alt", "Left GUI",
+		"Right Ctrl", "Right Shift", "Right Alt", "Right GUI",
+	}
+
+	for c := 'A'; c <= 'Z'; c++ {
+		names = append(names, string(c))
+	}
+
+	for i := 0; i <= 9; i++ {
+		names = append(names, fmt.Sprint(i), fmt.Sprintf("Keypad %d", i))
+	}
+
+	for i := 1; i <= 24; i++ {
+		names = append(names, fmt.Sprintf("F%d", i))
+	}
+
+	for _, name := range names {
+		keyNames[strings.ToLower(name)] = true
+	}
+}
@@ -0,0 +1,50 @@
+package input
+
+// KeyEvent is a key pressed or released remotely, identified by its SDL name.
+type KeyEvent struct {
+	Name    string `json:"key"`
+	Pressed bool   `json:"pressed"`
+}
+
+// RemoteKeys handles the keys and the events sent by a remote frontend.
+type RemoteKeys struct {
+	joypad   *Joypad
+	bindings Bindings
+
+	keys   <-chan KeyEvent
+	events <-chan Event
+}
+
+func NewRemoteKeys(joypad *Joypad, bindings Bindings, keys <-chan KeyEvent, events <-chan Event) Keys {
+	return &RemoteKeys{
+		joypad:   joypad,
+		bindings: bindings,
+
+		keys:   keys,
+		events: events,
+	}
+}
+
+func (r *RemoteKeys) Read() Event {
+	for {
+		select {
+		case event := <-r.events:
+			return event
+		case key := <-r.keys:
+			event := r.handleKey(key)
+			if event != None {
+				return event
+			}
+		default:
+			return None
+		}
+	}
+}
+
+func (r *RemoteKeys) handleKey(key KeyEvent) Event {
+	if key.Pressed {
+		return r.bindings.Press(r.joypad, key.Name, false)
+	}
+
+	return r.bindings.Release(r.joypad, key.Name)
+}
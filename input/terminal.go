@@ -0,0 +1,212 @@
+package input
+
+import (
+	"io"
+	"strings"
+	"time"
+)
+
+// Terminals only report key presses (repeated while a key is held), so keys
+// are released when they haven't been pressed for a while. This has to be
+// longer than the delay before keys start repeating, usually around 500ms.
+const DefaultHoldTime = 600 * time.Millisecond
+
+// Escape sequences of the special keys, and the SDL names they're bound with
+var sequences = map[string]string{
+	"\x1b[A":   "Up",
+	"\x1b[B":   "Down",
+	"\x1b[C":   "Right",
+	"\x1b[D":   "Left",
+	"\x1bOP":   "F1",
+	"\x1bOQ":   "F2",
+	"\x1bOR":   "F3",
+	"\x1bOS":   "F4",
+	"\x1b[15~": "F5",
+	"\x1b[17~": "F6",
+	"\x1b[18~": "F7",
+	"\x1b[19~": "F8",
+	"\x1b[20~": "F9",
+	"\x1b[21~": "F10",
+	"\x1b[23~": "F11",
+	"\x1b[24~": "F12",
+}
+
+// Ctrl-C quits, as signals aren't generated in raw mode.
+const interruptName = "Ctrl-C"
+
+// Names of the control characters
+var controls = map[byte]string{
+	0x03: interruptName,
+	'\t': "Tab",
+	'\r': "Return",
+	' ':  "Space",
+	0x1b: "Escape",
+	0x7f: "Backspace",
+}
+
+// TerminalKeys reads keys from a terminal in raw mode.
+type TerminalKeys struct {
+	joypad   *Joypad
+	bindings Bindings
+
+	names <-chan string
+	// Time for which keys are held after being pressed
+	holdTime time.Duration
+	// Time at which each held key, by name, is released
+	held map[string]time.Time
+	// Events to return on the next reads
+	pending []Event
+}
+
+// NewTerminalKeys handles the keys read from a terminal by ReadTerminal,
+// releasing them after holdTime (DefaultHoldTime if 0).
+func NewTerminalKeys(joypad *Joypad, bindings Bindings, names <-chan string, holdTime time.Duration) Keys {
+	if holdTime == 0 {
+		holdTime = DefaultHoldTime
+	}
+
+	return &TerminalKeys{
+		joypad:   joypad,
+		bindings: bindings,
+
+		names:    names,
+		holdTime: holdTime,
+		held:     make(map[string]time.Time),
+	}
+}
+
+// ReadTerminal reads keys from a terminal in the background, and sends their
+// SDL names until the terminal is closed.
+func ReadTerminal(r io.Reader) <-chan string {
+	names := make(chan string, 64)
+
+	go func() {
+		buffer := make([]byte, 64)
+
+		for {
+			n, err := r.Read(buffer)
+			if err != nil {
+				return
+			}
+
+			for _, name := range parseKeys(buffer[:n]) {
+				names <- name
+			}
+		}
+	}()
+
+	return names
+}
+
+// parseKeys returns the SDL names of the keys pressed. Unknown escape
+// sequences are skipped.
+func parseKeys(data []byte) []string {
+	var names []string
+
+	for len(data) > 0 {
+		if data[0] == 0x1b && len(data) > 1 {
+			length := sequenceLength(data)
+
+			name, ok := sequences[string(data[:length])]
+			if ok {
+				names = append(names, name)
+			}
+
+			data = data[length:]
+			continue
+		}
+
+		c := data[0]
+		data = data[1:]
+
+		if name, ok := controls[c]; ok {
+			names = append(names, name)
+		} else if c > ' ' && c < 0x7f {
+			names = append(names, strings.ToUpper(string(c)))
+		}
+	}
+
+	return names
+}
+
+// sequenceLength returns the length of the escape sequence data starts with:
+// ESC O and a letter, or ESC [, parameters and a final letter or tilde.
+func sequenceLength(data []byte) int {
+	if data[1] == 'O' {
+		if len(data) < 3 {
+			return len(data)
+		}
+
+		return 3
+	}
+
+	if data[1] != '[' {
+		return 1
+	}
+
+	for i := 2; i < len(data); i++ {
+		if data[i] >= 0x40 && data[i] <= 0x7e {
+			return i + 1
+		}
+	}
+
+	return len(data)
+}
+
+func (t *TerminalKeys) Read() Event {
+	for reading := true; reading; {
+		select {
+		case name := <-t.names:
+			t.press(name)
+		default:
+			reading = false
+		}
+	}
+
+	now := time.Now()
+	for name, release := range t.held {
+		if now.Before(release) {
+			continue
+		}
+
+		delete(t.held, name)
+
+		event := t.bindings.Release(t.joypad, name)
+		if event != None {
+			t.pending = append(t.pending, event)
+		}
+	}
+
+	if len(t.pending) == 0 {
+		return None
+	}
+
+	event := t.pending[0]
+	t.pending = t.pending[1:]
+
+	return event
+}
+
+// press presses the key with the given name, or keeps it pressed if it's
+// held. Hotkeys are also held, so that they aren't repeated.
+func (t *TerminalKeys) press(name string) {
+	if name == interruptName {
+		t.pending = append(t.pending, Quit)
+		return
+	}
+
+	if !t.bindings.Bound(name) {
+		return
+	}
+
+	_, held := t.held[name]
+	t.held[name] = time.Now().Add(t.holdTime)
+	if held {
+		return
+	}
+
+	event := t.bindings.Press(t.joypad, name, false)
+	if event != None {
+		t.pending = append(t.pending, event)
+	}
+}
@@ -1,5 +1,10 @@
 package interrupt
 
+import (
+	"encoding/binary"
+	"io"
+)
+
 // Interrupt Controller registers' addresses
 const (
 	IR uint16 = 0xff0f // Interrupt Request
@@ -68,3 +73,31 @@ func (ic *IC) Clear(mask byte) {
 func (ic *IC) Request(mask byte) {
 	ic.ir |= mask
 }
+
+type icState struct {
+	IR byte
+	IE byte
+}
+
+func (ic *IC) SaveState(w io.Writer) error {
+	state := icState{
+		IR: ic.ir,
+		IE: ic.ie,
+	}
+
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (ic *IC) LoadState(r io.Reader) error {
+	var state icState
+
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+
+	ic.ir = state.IR
+	ic.ie = state.IE
+
+	return nil
+}
@@ -2,26 +2,97 @@ package main
 
 import (
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"runtime/pprof"
+	"strings"
 
+	"github.com/bovarysme/bmo/api"
 	"github.com/bovarysme/bmo/beemo"
+	"github.com/bovarysme/bmo/config"
 	"github.com/bovarysme/bmo/debug"
+	"github.com/bovarysme/bmo/model"
+	"github.com/bovarysme/bmo/screen"
+	"github.com/bovarysme/bmo/script"
+	"github.com/bovarysme/bmo/server"
+	"github.com/bovarysme/bmo/window"
 )
 
+// cheatCodes collects the codes given with each -cheat flag.
+type cheatCodes []string
+
+func (c *cheatCodes) String() string {
+	return strings.Join(*c, ",")
+}
+
+func (c *cheatCodes) Set(code string) error {
+	*c = append(*c, code)
+	return nil
+}
+
 var debugFlag bool
+var lenient bool
+var cheats cheatCodes
+var fastForwardSpeed float64
+var slowMotionSpeed float64
+var uncapped bool
+var rewindInterval int
+var rewindBudget int
+var statePath string
+var recordPath string
+var playPath string
+var frames int
+var screenshotPath string
+var gifPath string
+var y4mPath string
+var rawPath string
 var screenScale int
+var terminal bool
+var serve string
+var rpcAddress string
+var scriptPath string
+var fullscreen bool
+var filter string
+var blend bool
 var cpuprofile string
+var modelName string
+var paletteName string
 var bootromPath string
 var romPath string
+var configPath string
 
 func init() {
 	flag.BoolVar(&debugFlag, "debug", false, "run the emulator in debug mode")
+	flag.BoolVar(&lenient, "lenient", false, "allow VRAM and OAM accesses during any PPU mode")
+	flag.Var(&cheats, "cheat", "enable a Game Genie or GameShark code (can be repeated)")
+	flag.Float64Var(&fastForwardSpeed, "ff-speed", 4, "speed factor while fast-forwarding (0 for uncapped)")
+	flag.Float64Var(&slowMotionSpeed, "slow-speed", 0.5, "speed factor while in slow motion")
+	flag.BoolVar(&uncapped, "uncapped", false, "run as fast as possible and report the average speed")
+	flag.IntVar(&rewindInterval, "rewind-interval", 4, "frames between rewind snapshots (0 to disable rewinding)")
+	flag.IntVar(&rewindBudget, "rewind-budget", 64, "memory used by rewind snapshots, in MiB")
 	flag.IntVar(&screenScale, "scale", 2, "screen scale factor")
+	flag.BoolVar(&terminal, "terminal", false, "draw the screen in the terminal and read the keys from it")
+	flag.StringVar(&serve, "serve", "", "serve a web frontend on an address (e.g. localhost:8080) instead of opening a window")
+	flag.StringVar(&rpcAddress, "rpc", "", "serve the JSON-RPC automation API, which is unauthenticated and can read any file, on a loopback address (e.g. localhost:9000), the ROM being optional")
+	flag.StringVar(&scriptPath, "script", "", "run a Lua script alongside the emulator")
+	flag.BoolVar(&fullscreen, "fullscreen", false, "start in fullscreen")
+	flag.StringVar(&filter, "filter", "none", "screen filter (none, scale2x, scale3x or lcd)")
+	flag.BoolVar(&blend, "blend", false, "blend frames to emulate the LCD's ghosting")
 	flag.StringVar(&cpuprofile, "cpuprofile", "", "write a CPU profile")
 	flag.StringVar(&romPath, "rom", "", "path to the ROM file")
-	flag.StringVar(&bootromPath, "bootrom", "roms/bootrom.gb", "path to the bootrom file")
+	flag.StringVar(&modelName, "model", "dmg", "hardware model (dmg0, dmg, mgb, sgb, sgb2 or cgb)")
+	flag.StringVar(&paletteName, "palette", "", "palette preset or user palette (the model's default one if empty)")
+	flag.StringVar(&bootromPath, "bootrom", "", "path to the bootrom file (starts from the post-boot state if empty)")
+	flag.StringVar(&configPath, "config", "bmo.json", "path to the configuration file")
+	flag.StringVar(&statePath, "state", "", "path to a save state to start from")
+	flag.StringVar(&recordPath, "record", "", "record the joypad inputs to a movie file")
+	flag.StringVar(&playPath, "play", "", "play back the joypad inputs of a movie file")
+	flag.IntVar(&frames, "frames", 0, "run headless for a number of frames, then print the last frame's hash")
+	flag.StringVar(&screenshotPath, "screenshot", "", "write the last frame to a PNG file when running headless")
+	flag.StringVar(&gifPath, "gif", "", "record the video to an animated GIF")
+	flag.StringVar(&y4mPath, "y4m", "", "record the video to a Y4M file (- for the standard output)")
+	flag.StringVar(&rawPath, "raw", "", "record the video as raw RGB24 frames (- for the standard output)")
 
 	flag.Parse()
 }
@@ -41,12 +112,87 @@ func main() {
 		defer pprof.StopCPUProfile()
 	}
 
-	bmo, err := beemo.NewBMO(bootromPath, romPath, screenScale)
+	m, err := model.Parse(modelName)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	cfg, err := config.Load(configPath)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	// The web frontend replaces the window and the terminal.
+	var frontend beemo.Window = window.Window{}
+	if serve != "" {
+		frontend = &server.Frontend{Address: serve}
+	}
+
+	options := beemo.Options{
+		Model:       m,
+		BootromPath: bootromPath,
+		ROMPath:     romPath,
+		Terminal:    terminal && serve == "",
+		Window:      frontend,
+		Screen: screen.Options{
+			Scale:      screenScale,
+			Fullscreen: fullscreen,
+			Filter:     filter,
+			Blend:      blend,
+		},
+		Headless: frames > 0,
+		Config:   cfg,
+
+		Lenient: lenient,
+		Palette: paletteName,
+		Cheats:  cheats,
+
+		FastForwardSpeed: fastForwardSpeed,
+		SlowMotionSpeed:  slowMotionSpeed,
+		Uncapped:         uncapped || frames > 0,
+
+		RewindInterval: rewindInterval,
+		RewindBudget:   rewindBudget << 20,
+
+		StatePath:  statePath,
+		RecordPath: recordPath,
+		PlayPath:   playPath,
+
+		GIFPath: gifPath,
+		Y4MPath: y4mPath,
+		RawPath: rawPath,
+	}
+
+	// Headless runs can't rewind, so they don't need snapshots.
+	if options.Headless {
+		options.RewindInterval = 0
+	}
+
+	if rpcAddress != "" {
+		err = runAPI(options)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		return
+	}
+
+	bmo, err := beemo.NewBMO(options)
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	if debugFlag {
+	if scriptPath != "" {
+		s, err := script.Load(bmo, scriptPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer s.Close()
+	}
+
+	if frames > 0 {
+		err = runHeadless(bmo)
+	} else if debugFlag {
 		debugger := debug.NewDebugger(bmo)
 		err = debugger.Run()
 	} else {
@@ -57,3 +203,36 @@ func main() {
 		log.Fatal(err)
 	}
 }
+
+// runAPI serves the JSON-RPC API until the program is interrupted.
+func runAPI(options beemo.Options) error {
+	a, err := api.NewAPI(options)
+	if err != nil {
+		return err
+	}
+
+	return api.Serve(rpcAddress, a)
+}
+
+func runHeadless(bmo *beemo.BMO) error {
+	err := bmo.RunFrames(frames)
+	if err != nil {
+		return err
+	}
+
+	if screenshotPath != "" {
+		err = bmo.Screenshot(screenshotPath)
+		if err != nil {
+			return err
+		}
+	}
+
+	// Don't mix the hash with a video written to the standard output.
+	if y4mPath == "-" || rawPath == "-" {
+		log.Printf("Frame hash: %s\n", bmo.FrameHash())
+	} else {
+		fmt.Println(bmo.FrameHash())
+	}
+
+	return bmo.Shutdown()
+}
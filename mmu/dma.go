@@ -0,0 +1,88 @@
+package mmu
+
+const dmaLength = OAMRAMSize
+
+// OAM DMA transfers 160 bytes to OAM, one byte per M-cycle. The transfer
+// starts after a one M-cycle setup delay following the write to the DMA
+// register.
+type dma struct {
+	active bool
+	source uint16
+	index  uint16
+	// Last byte transferred, which the CPU reads back on a bus conflict
+	value byte
+
+	// A write to the DMA register while a transfer is running restarts it
+	// once the setup delay has elapsed.
+	delay         int
+	pendingSource uint16
+}
+
+func (d *dma) start(value byte) {
+	source := uint16(value) << 8
+	// Sources past the work RAM are mapped to the work RAM.
+	if source >= 0xe000 {
+		source -= 0x2000
+	}
+
+	d.pendingSource = source
+	// The write cycle itself, plus the setup delay.
+	d.delay = 2
+}
+
+// isVideoBus returns whether an address is accessed through the video bus
+// rather than the external bus.
+func isVideoBus(address uint16) bool {
+	return address >= VRAMStart && address <= VRAMEnd
+}
+
+// isBlocked returns whether the CPU can't access an address because the
+// running transfer is using the same bus (or OAM).
+func (d *dma) isBlocked(address uint16) bool {
+	if !d.active || address >= ioStart {
+		return false
+	}
+
+	if address >= OAMRAMStart {
+		return true
+	}
+
+	return isVideoBus(address) == isVideoBus(d.source)
+}
+
+func (m *MMU) Step(cycles int) {
+	for i := 0; i < cycles; i++ {
+		m.stepDMA()
+	}
+}
+
+func (m *MMU) stepDMA() {
+	d := &m.dma
+
+	if d.active {
+		d.value = m.readDMASource(d.source + d.index)
+		m.ppu.PokeByte(OAMRAMStart+d.index, d.value)
+
+		d.index++
+		if d.index >= dmaLength {
+			d.active = false
+		}
+	}
+
+	if d.delay > 0 {
+		d.delay--
+		if d.delay == 0 {
+			d.active = true
+			d.source = d.pendingSource
+			d.index = 0
+		}
+	}
+}
+
+func (m *MMU) readDMASource(address uint16) byte {
+	if isVideoBus(address) {
+		return m.ppu.PeekByte(address)
+	}
+
+	return m.readByte(address)
+}
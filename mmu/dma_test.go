@@ -0,0 +1,163 @@
+package mmu
+
+import "testing"
+
+// Values found in each memory area, which tell apart the bytes read back on
+// bus conflicts
+const (
+	romValue  = 0x11
+	vramValue = 0x22
+	wramValue = 0x33
+	hramValue = 0x44
+)
+
+type testCartridge struct{}
+
+func (c *testCartridge) ReadByte(address uint16) byte {
+	return romValue
+}
+
+func (c *testCartridge) WriteByte(address uint16, value byte) {}
+
+type testVideoMemory struct {
+	vram [0x2000]byte
+	oam  [OAMRAMSize]byte
+}
+
+func (v *testVideoMemory) ReadByte(address uint16) byte {
+	return v.PeekByte(address)
+}
+
+func (v *testVideoMemory) WriteByte(address uint16, value byte) {
+	v.PokeByte(address, value)
+}
+
+func (v *testVideoMemory) PeekByte(address uint16) byte {
+	if address >= OAMRAMStart {
+		return v.oam[address-OAMRAMStart]
+	}
+
+	return v.vram[address-VRAMStart]
+}
+
+func (v *testVideoMemory) PokeByte(address uint16, value byte) {
+	if address >= OAMRAMStart {
+		v.oam[address-OAMRAMStart] = value
+	} else {
+		v.vram[address-VRAMStart] = value
+	}
+}
+
+// newTestMMU returns an MMU whose memory areas are filled with their test
+// values, offset by the address' low byte.
+func newTestMMU() (*MMU, *testVideoMemory) {
+	m := &MMU{
+		cartridge: &testCartridge{},
+	}
+
+	// Unmaps the boot ROM
+	m.io[0x50] = 1
+
+	video := &testVideoMemory{}
+	m.LinkPPU(video)
+
+	for i := range video.vram {
+		video.vram[i] = vramValue + byte(i)
+	}
+
+	for i := range m.wram {
+		m.wram[i] = wramValue + byte(i)
+	}
+
+	for i := range m.hram {
+		m.hram[i] = hramValue + byte(i)
+	}
+
+	return m, video
+}
+
+func TestDMASource(t *testing.T) {
+	tests := []struct {
+		value      byte
+		wantSource uint16
+	}{
+		{0x00, 0x0000},
+		{0x80, 0x8000},
+		{0xc1, 0xc100},
+		{0xdf, 0xdf00},
+		// Sources past the work RAM are mapped to the work RAM.
+		{0xe0, 0xc000},
+		{0xfe, 0xde00},
+		{0xff, 0xdf00},
+	}
+
+	for _, test := range tests {
+		m, video := newTestMMU()
+
+		m.WriteByte(dmaRegisterAddress, test.value)
+		// The write cycle, the setup delay, then a byte per M-cycle
+		m.Step(2 + dmaLength)
+
+		if m.dma.active {
+			t.Errorf("DMA from %#02x: transfer still running", test.value)
+		}
+
+		if m.dma.source != test.wantSource {
+			t.Errorf("DMA from %#02x: source is %#04x, want %#04x", test.value, m.dma.source, test.wantSource)
+		}
+
+		for i := uint16(0); i < dmaLength; i++ {
+			want := m.readDMASource(test.wantSource + i)
+			if video.oam[i] != want {
+				t.Errorf("DMA from %#02x: OAM byte %d is %#02x, want %#02x", test.value, i, video.oam[i], want)
+				break
+			}
+		}
+	}
+}
+
+func TestDMABlockedReads(t *testing.T) {
+	tests := []struct {
+		name    string
+		value   byte
+		address uint16
+		// Byte read by the CPU, 0 meaning the last byte transferred
+		want byte
+	}{
+		{"ROM during a ROM transfer", 0x00, 0x0150, 0},
+		{"WRAM during a ROM transfer", 0x00, 0xc010, 0},
+		{"VRAM during a ROM transfer", 0x00, 0x8010, vramValue + 0x10},
+		{"WRAM during a WRAM transfer", 0xc1, 0xc010, 0},
+		{"echo RAM during a WRAM transfer", 0xc1, 0xe010, 0},
+		{"VRAM during a WRAM transfer", 0xc1, 0x8010, vramValue + 0x10},
+		{"VRAM during a VRAM transfer", 0x80, 0x8010, 0},
+		{"ROM during a VRAM transfer", 0x80, 0x0150, romValue},
+		{"WRAM during a VRAM transfer", 0x80, 0xc010, wramValue + 0x10},
+		{"OAM during a WRAM transfer", 0xc1, 0xfe10, 0xff},
+		{"HRAM during a WRAM transfer", 0xc1, 0xff90, hramValue + 0x10},
+	}
+
+	for _, test := range tests {
+		m, _ := newTestMMU()
+
+		m.WriteByte(dmaRegisterAddress, test.value)
+		// The write cycle and the setup delay, then the first byte
+		m.Step(3)
+
+		want := test.want
+		if want == 0 {
+			want = m.readDMASource(m.dma.source)
+		}
+
+		value := m.ReadByte(test.address)
+		if value != want {
+			t.Errorf("%s: read %#02x, want %#02x", test.name, value, want)
+		}
+
+		// Writes to the blocked areas are ignored.
+		m.WriteByte(test.address, 0x99)
+		if m.dma.isBlocked(test.address) && m.readDMASource(test.address) == 0x99 {
+			t.Errorf("%s: write went through", test.name)
+		}
+	}
+}
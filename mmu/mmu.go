@@ -1,11 +1,14 @@
 package mmu
 
 import (
+	"encoding/binary"
 	"errors"
+	"io"
 	"io/ioutil"
 
 	"github.com/bovarysme/bmo/input"
 	"github.com/bovarysme/bmo/interrupt"
+	"github.com/bovarysme/bmo/model"
 	"github.com/bovarysme/bmo/timer"
 )
 
@@ -26,10 +29,16 @@ const (
 	wramEnd   = 0xdfff
 	wramSize  = wramEnd - wramStart + 1
 
+	echoRAMStart = 0xe000
+	echoRAMEnd   = 0xfdff
+
 	OAMRAMStart = 0xfe00
 	OAMRAMEnd   = 0xfe9f
 	OAMRAMSize  = OAMRAMEnd - OAMRAMStart + 1
 
+	UnusableStart = 0xfea0
+	UnusableEnd   = 0xfeff
+
 	ioStart = 0xff00
 	ioEnd   = 0xff7f
 	ioSize  = ioEnd - ioStart + 1
@@ -41,31 +50,147 @@ const (
 
 const dmaRegisterAddress uint16 = 0xff46
 
+// CGB speed switch register
+const KEY1 uint16 = 0xff4d
+
+// KEY1 register's masks
+const (
+	prepareSpeedSwitch byte = 1
+	currentSpeed       byte = 1 << 7
+)
+
+// Bits of the IO registers which always read as 1 (either because they're
+// unused or because the register is write-only or unmapped)
+var ioMasks = [ioSize]byte{
+	// P1, SB, SC, -, DIV, TIMA, TMA, TAC
+	0xc0, 0x00, 0x7e, 0xff, 0x00, 0x00, 0x00, 0xf8,
+	// -, -, -, -, -, -, -, IF
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xe0,
+	// NR10, NR11, NR12, NR13, NR14, -, NR21, NR22
+	0x80, 0x3f, 0x00, 0xff, 0xbf, 0xff, 0x3f, 0x00,
+	// NR23, NR24, NR30, NR31, NR32, NR33, NR34, -
+	0xff, 0xbf, 0x7f, 0xff, 0x9f, 0xff, 0xbf, 0xff,
+	// NR41, NR42, NR43, NR44, NR50, NR51, NR52, -
+	0xff, 0x00, 0x00, 0xbf, 0x00, 0x00, 0x70, 0xff,
+	// -, -, -, -, -, -, -, -
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	// Wave pattern RAM
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	// LCDC, STAT, SCY, SCX, LY, LYC, DMA, BGP
+	0x00, 0x80, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00,
+	// OBP0, OBP1, WY, WX, -, KEY1, -, -
+	0x00, 0x00, 0x00, 0x00, 0xff, 0x00, 0xff, 0xff,
+	// Boot ROM disable register and unmapped registers
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+	0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff,
+}
+
+// Boot ROM disable register
+const bootromDisable uint16 = 0xff50
+
+// Values left by the DMG boot ROM in the IO registers stored by the MMU
+var postBootIO = map[uint16]byte{
+	0xff01: 0x00, // SB
+	0xff02: 0x7e, // SC
+	0xff10: 0x80, // NR10
+	0xff11: 0xbf, // NR11
+	0xff12: 0xf3, // NR12
+	0xff13: 0xff, // NR13
+	0xff14: 0xbf, // NR14
+	0xff16: 0x3f, // NR21
+	0xff17: 0x00, // NR22
+	0xff18: 0xff, // NR23
+	0xff19: 0xbf, // NR24
+	0xff1a: 0x7f, // NR30
+	0xff1b: 0xff, // NR31
+	0xff1c: 0x9f, // NR32
+	0xff1d: 0xff, // NR33
+	0xff1e: 0xbf, // NR34
+	0xff20: 0xff, // NR41
+	0xff21: 0x00, // NR42
+	0xff22: 0x00, // NR43
+	0xff23: 0xbf, // NR44
+	0xff24: 0x77, // NR50
+	0xff25: 0xf3, // NR51
+	0xff26: 0xf1, // NR52
+	0xff40: 0x91, // LCDC
+	0xff41: 0x85, // STAT
+	0xff46: 0xff, // DMA
+	0xff47: 0xfc, // BGP
+
+	bootromDisable: 0x01,
+}
+
+// Values left by the other models' boot ROMs which differ from the DMG ones
+// (the SGB and CGB STAT and LY being unknown)
+var postBootModelIO = map[model.Model]map[uint16]byte{
+	model.DMG0: {
+		0xff41: 0x81, // STAT
+	},
+	model.SGB: {
+		0xff26: 0xf0, // NR52
+	},
+	model.SGB2: {
+		0xff26: 0xf0, // NR52
+	},
+	model.CGB: {
+		0xff02: 0x7f, // SC
+		0xff46: 0x00, // DMA
+	},
+}
+
 type Memory interface {
 	ReadByte(address uint16) byte
 	WriteByte(address uint16, value byte)
 }
 
+// VideoMemory is implemented by the PPU. PeekByte and PokeByte bypass the
+// restrictions on CPU accesses to VRAM and OAM.
+type VideoMemory interface {
+	Memory
+	PeekByte(address uint16) byte
+	PokeByte(address uint16, value byte)
+}
+
 type MMU struct {
 	bootrom   []byte
 	cartridge Memory
 	ic        Memory
 	joypad    Memory
-	ppu       Memory
+	ppu       VideoMemory
 	timer     Memory
 
 	wram [wramSize]byte
 	io   [ioSize]byte
 	hram [hramSize]byte
+
+	dma dma
+
+	// CGB-only features (i.e. speed switching) are enabled
+	cgb  bool
+	key1 byte
 }
 
-func NewMMU(bootromPath string, cartridge Memory) (*MMU, error) {
+// NewMMU creates an MMU, loading the model's boot ROM unless its path is
+// empty (in which case SkipBoot has to be called).
+func NewMMU(bootromPath string, m model.Model, cartridge Memory) (*MMU, error) {
+	if bootromPath == "" {
+		return &MMU{
+			cartridge: cartridge,
+		}, nil
+	}
+
 	bootrom, err := ioutil.ReadFile(bootromPath)
 	if err != nil {
 		return nil, err
 	}
 
-	if len(bootrom) != 256 {
+	if len(bootrom) != m.BootromSize() {
 		return nil, errors.New("Invalid bootrom size")
 	}
 
@@ -75,6 +200,20 @@ func NewMMU(bootromPath string, cartridge Memory) (*MMU, error) {
 	}, nil
 }
 
+// SkipBoot sets the IO registers to the values left by a model's boot ROM,
+// and unmaps it. KEY1 is left in normal speed mode.
+func (m *MMU) SkipBoot(hardware model.Model) {
+	for address, value := range postBootIO {
+		m.io[address-ioStart] = value
+	}
+
+	for address, value := range postBootModelIO[hardware] {
+		m.io[address-ioStart] = value
+	}
+
+	m.key1 = 0
+}
+
 // XXX
 func (m *MMU) LinkIC(ic Memory) {
 	m.ic = ic
@@ -84,7 +223,7 @@ func (m *MMU) LinkJoypad(joypad Memory) {
 	m.joypad = joypad
 }
 
-func (m *MMU) LinkPPU(ppu Memory) {
+func (m *MMU) LinkPPU(ppu VideoMemory) {
 	m.ppu = ppu
 }
 
@@ -92,12 +231,67 @@ func (m *MMU) LinkTimer(timer Memory) {
 	m.timer = timer
 }
 
+func (m *MMU) SetCGB(cgb bool) {
+	m.cgb = cgb
+}
+
+// SwitchSpeed toggles the CPU speed if a switch has been prepared, and
+// returns whether it did.
+func (m *MMU) SwitchSpeed() bool {
+	if !m.cgb || m.key1&prepareSpeedSwitch == 0 {
+		return false
+	}
+
+	m.key1 ^= currentSpeed
+	m.key1 &^= prepareSpeedSwitch
+
+	return true
+}
+
+func (m *MMU) DoubleSpeed() bool {
+	return m.key1&currentSpeed == currentSpeed
+}
+
+// ReadByte reads a byte on behalf of the CPU. While an OAM DMA transfer is
+// running, OAM can't be read and reads from the bus used by the transfer
+// return the byte being transferred.
 func (m *MMU) ReadByte(address uint16) byte {
+	if m.dma.isBlocked(address) {
+		if address >= OAMRAMStart {
+			return 0xff
+		}
+
+		return m.dma.value
+	}
+
+	return m.readByte(address)
+}
+
+func (m *MMU) isBootromMapped(address uint16) bool {
+	if m.io[bootromDisable-ioStart] != 0 {
+		return false
+	}
+
+	// The CGB boot ROM leaves the cartridge header visible.
+	return address < 0x100 || address >= 0x200 && int(address) < len(m.bootrom)
+}
+
+// PeekByte reads a byte without side effects (e.g. for debuggers), regardless
+// of a running OAM DMA transfer and of the PPU's restrictions on VRAM and OAM.
+func (m *MMU) PeekByte(address uint16) byte {
+	if isVideoBus(address) || address >= OAMRAMStart && address <= UnusableEnd {
+		return m.ppu.PeekByte(address)
+	}
+
+	return m.readByte(address)
+}
+
+func (m *MMU) readByte(address uint16) byte {
 	var value byte
 
 	switch {
 	case address >= romStart && address <= romEnd:
-		if address < 0x100 && m.io[0x50] == 0 {
+		if m.isBootromMapped(address) {
 			value = m.bootrom[address]
 		} else {
 			value = m.cartridge.ReadByte(address)
@@ -112,7 +306,13 @@ func (m *MMU) ReadByte(address uint16) byte {
 		address -= wramStart
 		value = m.wram[address]
 
-	case address >= OAMRAMStart && address <= OAMRAMEnd:
+	case address >= echoRAMStart && address <= echoRAMEnd:
+		address -= echoRAMStart
+		value = m.wram[address]
+
+	// The PPU also handles the unusable area, whose reads depend on whether
+	// OAM is accessible.
+	case address >= OAMRAMStart && address <= UnusableEnd:
 		value = m.ppu.ReadByte(address)
 
 	case address >= ioStart && address <= ioEnd:
@@ -125,11 +325,17 @@ func (m *MMU) ReadByte(address uint16) byte {
 			value = m.ic.ReadByte(address)
 		case 0xff44:
 			value = m.ppu.ReadByte(address)
+		case KEY1:
+			value = 0xff
+			if m.cgb {
+				value = 0x7e | m.key1
+			}
 		default:
-			address -= ioStart
-			value = m.io[address]
+			value = m.io[address-ioStart]
 		}
 
+		value |= ioMasks[address-ioStart]
+
 	case address >= hramStart && address <= hramEnd:
 		address -= hramStart
 		value = m.hram[address]
@@ -145,7 +351,13 @@ func (m *MMU) ReadWord(address uint16) uint16 {
 	return uint16(m.ReadByte(address+1))<<8 | uint16(m.ReadByte(address))
 }
 
+// WriteByte writes a byte on behalf of the CPU. Writes to the bus used by a
+// running OAM DMA transfer (or to OAM) are ignored.
 func (m *MMU) WriteByte(address uint16, value byte) {
+	if m.dma.isBlocked(address) {
+		return
+	}
+
 	switch {
 	case address >= romStart && address <= romEnd:
 		m.cartridge.WriteByte(address, value)
@@ -160,6 +372,10 @@ func (m *MMU) WriteByte(address uint16, value byte) {
 		address -= wramStart
 		m.wram[address] = value
 
+	case address >= echoRAMStart && address <= echoRAMEnd:
+		address -= echoRAMStart
+		m.wram[address] = value
+
 	case address >= OAMRAMStart && address <= OAMRAMEnd:
 		m.ppu.WriteByte(address, value)
 
@@ -173,9 +389,11 @@ func (m *MMU) WriteByte(address uint16, value byte) {
 			m.ic.WriteByte(address, value)
 		case 0xff44:
 			m.ppu.WriteByte(address, value)
+		case KEY1:
+			m.key1 = m.key1&currentSpeed | value&prepareSpeedSwitch
 		default:
 			if address == dmaRegisterAddress {
-				m.handleDMA(value)
+				m.dma.start(value)
 			}
 
 			address -= ioStart
@@ -196,15 +414,62 @@ func (m *MMU) WriteWord(address, value uint16) {
 	m.WriteByte(address+1, byte(value>>8))
 }
 
-func (m *MMU) handleDMA(value byte) {
-	source := uint16(value) << 8
-	dest := uint16(OAMRAMStart)
+type mmuState struct {
+	WRAM [wramSize]byte
+	IO   [ioSize]byte
+	HRAM [hramSize]byte
 
-	for i := 0; i < 0xa0; i++ {
-		b := m.ReadByte(source)
-		m.WriteByte(dest, b)
+	DMAActive        bool
+	DMASource        uint16
+	DMAIndex         uint16
+	DMAValue         byte
+	DMADelay         int32
+	DMAPendingSource uint16
+
+	KEY1 byte
+}
 
-		source++
-		dest++
+func (m *MMU) SaveState(w io.Writer) error {
+	state := mmuState{
+		WRAM: m.wram,
+		IO:   m.io,
+		HRAM: m.hram,
+
+		DMAActive:        m.dma.active,
+		DMASource:        m.dma.source,
+		DMAIndex:         m.dma.index,
+		DMAValue:         m.dma.value,
+		DMADelay:         int32(m.dma.delay),
+		DMAPendingSource: m.dma.pendingSource,
+
+		KEY1: m.key1,
 	}
+
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (m *MMU) LoadState(r io.Reader) error {
+	var state mmuState
+
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+
+	m.wram = state.WRAM
+	m.io = state.IO
+	m.hram = state.HRAM
+
+	m.dma = dma{
+		active:        state.DMAActive,
+		source:        state.DMASource,
+		index:         state.DMAIndex,
+		value:         state.DMAValue,
+		delay:         int(state.DMADelay),
+		pendingSource: state.DMAPendingSource,
+	}
+
+	m.key1 = state.KEY1
+
+	return nil
 }
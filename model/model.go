@@ -0,0 +1,57 @@
+package model
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Model is a Game Boy hardware model. The zero value is the original DMG.
+type Model byte
+
+const (
+	DMG Model = iota
+	// Early DMG, with a different boot ROM
+	DMG0
+	// Game Boy Pocket
+	MGB
+	// Super Game Boy
+	SGB
+	SGB2
+	// Game Boy Color
+	CGB
+)
+
+var names = [...]string{"DMG", "DMG0", "MGB", "SGB", "SGB2", "CGB"}
+
+// Parse returns the model with the given name, regardless of case.
+func Parse(name string) (Model, error) {
+	for i, n := range names {
+		if strings.EqualFold(name, n) {
+			return Model(i), nil
+		}
+	}
+
+	return DMG, fmt.Errorf("Unknown model: %s", name)
+}
+
+func (m Model) String() string {
+	return names[m]
+}
+
+// BootromSize returns the size of the model's boot ROM. The CGB one is mapped
+// at 0x0000-0x00ff and 0x0200-0x08ff, around the cartridge header.
+func (m Model) BootromSize() int {
+	if m == CGB {
+		return 2304
+	}
+
+	return 256
+}
+
+func (m Model) IsSGB() bool {
+	return m == SGB || m == SGB2
+}
+
+func (m Model) IsCGB() bool {
+	return m == CGB
+}
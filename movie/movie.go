@@ -0,0 +1,175 @@
+package movie
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"os"
+
+	"github.com/bovarysme/bmo/input"
+)
+
+const version = 1
+
+var magic = [4]byte{'B', 'M', 'V', 0x1a}
+
+// Start conditions
+const (
+	PowerOn byte = iota
+	SaveState
+)
+
+type header struct {
+	Magic          [4]byte
+	Version        byte
+	ROMChecksum    uint32
+	StartCondition byte
+	StateSize      uint32
+	Frames         uint32
+}
+
+// Movie holds the joypad state of each frame of a recording. Movies starting
+// from power-on also embed the initial state, so that the battery-backed RAM
+// found at the time of the recording is restored before playback.
+type Movie struct {
+	ROMChecksum    uint32
+	StartCondition byte
+	State          []byte
+	Inputs         []byte
+}
+
+func NewMovie(romChecksum uint32, startCondition byte, state []byte) *Movie {
+	return &Movie{
+		ROMChecksum:    romChecksum,
+		StartCondition: startCondition,
+		State:          state,
+	}
+}
+
+func Load(path string) (*Movie, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(file)
+
+	var h header
+	err = binary.Read(reader, binary.LittleEndian, &h)
+	if err != nil {
+		return nil, err
+	}
+
+	if h.Magic != magic || h.Version != version {
+		return nil, errors.New("Invalid movie file")
+	}
+
+	// The sizes are checked against the file's before allocating anything,
+	// so that corrupted files are rejected early.
+	size := int64(binary.Size(h)) + int64(h.StateSize) + int64(h.Frames)
+	if size != info.Size() {
+		return nil, errors.New("Invalid movie file")
+	}
+
+	movie := &Movie{
+		ROMChecksum:    h.ROMChecksum,
+		StartCondition: h.StartCondition,
+		State:          make([]byte, h.StateSize),
+		Inputs:         make([]byte, h.Frames),
+	}
+
+	_, err = io.ReadFull(reader, movie.State)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.ReadFull(reader, movie.Inputs)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Printf("Loaded a %d frames movie from '%s'\n", h.Frames, path)
+
+	return movie, nil
+}
+
+func (m *Movie) Save(path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	h := header{
+		Magic:          magic,
+		Version:        version,
+		ROMChecksum:    m.ROMChecksum,
+		StartCondition: m.StartCondition,
+		StateSize:      uint32(len(m.State)),
+		Frames:         uint32(len(m.Inputs)),
+	}
+
+	err = binary.Write(file, binary.LittleEndian, &h)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(m.State)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(m.Inputs)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Saved a %d frames movie to '%s'\n", h.Frames, path)
+
+	return nil
+}
+
+// Record appends the joypad state of a frame.
+func (m *Movie) Record(state byte) {
+	m.Inputs = append(m.Inputs, state)
+}
+
+// Player is a Keys implementation feeding the inputs of a movie to the
+// joypad, one frame at a time. Events (e.g. quitting) still come from
+// another Keys implementation, which mustn't be linked to the same joypad.
+type Player struct {
+	movie  *Movie
+	joypad *input.Joypad
+	keys   input.Keys
+
+	frame int
+}
+
+func NewPlayer(movie *Movie, joypad *input.Joypad, keys input.Keys) *Player {
+	return &Player{
+		movie:  movie,
+		joypad: joypad,
+		keys:   keys,
+	}
+}
+
+func (p *Player) Read() input.Event {
+	if p.frame < len(p.movie.Inputs) {
+		p.joypad.SetState(p.movie.Inputs[p.frame])
+
+		p.frame++
+		if p.frame == len(p.movie.Inputs) {
+			log.Println("Movie playback finished")
+		}
+	}
+
+	return p.keys.Read()
+}
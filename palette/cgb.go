@@ -0,0 +1,273 @@
+package palette
+
+import (
+	"github.com/bovarysme/bmo/cartridge"
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// Colors of the palettes of the CGB boot ROM for DMG games, in the RGB555
+// format of the CGB
+var cgbColors = [...]uint16{
+	0x7fff, 0x32bf, 0x00d0, 0x0000, // 0
+	0x639f, 0x4279, 0x15b0, 0x04cb, // 1
+	0x7fff, 0x6e31, 0x454a, 0x0000, // 2
+	0x7fff, 0x1bef, 0x0200, 0x0000, // 3
+	0x7fff, 0x421f, 0x1cf2, 0x0000, // 4
+	0x7fff, 0x5294, 0x294a, 0x0000, // 5
+	0x7fff, 0x03ff, 0x012f, 0x0000, // 6
+	0x7fff, 0x03ef, 0x01d6, 0x0000, // 7
+	0x7fff, 0x42b5, 0x3dc8, 0x0000, // 8
+	0x7e74, 0x03ff, 0x0180, 0x0000, // 9
+	0x67ff, 0x77ac, 0x1a13, 0x2d6b, // 10
+	0x7ed6, 0x4bff, 0x2175, 0x0000, // 11
+	0x53ff, 0x4a5f, 0x7e52, 0x0000, // 12
+	0x4fff, 0x7ed2, 0x3a4c, 0x1ce0, // 13
+	0x03ed, 0x7fff, 0x255f, 0x0000, // 14
+	0x036a, 0x021f, 0x03ff, 0x7fff, // 15
+	0x7fff, 0x01df, 0x0112, 0x0000, // 16
+	0x231f, 0x035f, 0x00f2, 0x0009, // 17
+	0x7fff, 0x03ea, 0x011f, 0x0000, // 18
+	0x299f, 0x001a, 0x000c, 0x0000, // 19
+	0x7fff, 0x027f, 0x001f, 0x0000, // 20
+	0x7fff, 0x03e0, 0x0206, 0x0120, // 21
+	0x7fff, 0x7eeb, 0x001f, 0x7c00, // 22
+	0x7fff, 0x3fff, 0x7e00, 0x001f, // 23
+	0x7fff, 0x03ff, 0x001f, 0x0000, // 24
+	0x03ff, 0x001f, 0x000c, 0x0000, // 25
+	0x7fff, 0x033f, 0x0193, 0x0000, // 26
+	0x0000, 0x4200, 0x037f, 0x7fff, // 27
+	0x7fff, 0x7e8c, 0x7c00, 0x0000, // 28
+	0x7fff, 0x1bef, 0x6180, 0x0000, // 29
+}
+
+// Palette combinations of the CGB boot ROM, as the indexes in cgbColors of
+// the first color of their OBJ0, OBJ1 and BG palettes (a few of them
+// straddling two palettes)
+var cgbCombinations = [...][3]int{
+	{4 * 4, 4 * 4, 29 * 4},     // 0, Right + A
+	{18 * 4, 18 * 4, 18 * 4},   // 1, Right
+	{20 * 4, 20 * 4, 20 * 4},   // 2
+	{24 * 4, 24 * 4, 24 * 4},   // 3, Down + A
+	{9 * 4, 9 * 4, 9 * 4},      // 4
+	{0 * 4, 0 * 4, 0 * 4},      // 5, Up
+	{27 * 4, 27 * 4, 27 * 4},   // 6, Right + B
+	{5 * 4, 5 * 4, 5 * 4},      // 7, Left + B
+	{12 * 4, 12 * 4, 12 * 4},   // 8, Down
+	{26 * 4, 26 * 4, 26 * 4},   // 9
+	{16 * 4, 8 * 4, 8 * 4},     // 10
+	{4 * 4, 28 * 4, 28 * 4},    // 11
+	{4 * 4, 2 * 4, 2 * 4},      // 12
+	{3 * 4, 4 * 4, 4 * 4},      // 13
+	{4 * 4, 29 * 4, 29 * 4},    // 14
+	{28 * 4, 4 * 4, 28 * 4},    // 15
+	{2 * 4, 17 * 4, 2 * 4},     // 16
+	{16 * 4, 16 * 4, 8 * 4},    // 17
+	{4 * 4, 4 * 4, 7 * 4},      // 18
+	{4 * 4, 4 * 4, 18 * 4},     // 19
+	{4 * 4, 4 * 4, 20 * 4},     // 20
+	{19 * 4, 19 * 4, 9 * 4},    // 21
+	{4*4 - 1, 4*4 - 1, 11 * 4}, // 22
+	{17 * 4, 17 * 4, 2 * 4},    // 23
+	{4 * 4, 4 * 4, 2 * 4},      // 24
+	{4 * 4, 4 * 4, 3 * 4},      // 25
+	{28 * 4, 28 * 4, 0 * 4},    // 26
+	{3 * 4, 3 * 4, 0 * 4},      // 27
+	{0 * 4, 0 * 4, 1 * 4},      // 28, Up + B
+	{18 * 4, 22 * 4, 18 * 4},   // 29
+	{20 * 4, 22 * 4, 20 * 4},   // 30
+	{24 * 4, 22 * 4, 24 * 4},   // 31
+	{16 * 4, 22 * 4, 8 * 4},    // 32
+	{17 * 4, 4 * 4, 13 * 4},    // 33
+	{28*4 - 1, 0 * 4, 14 * 4},  // 34
+	{28*4 - 1, 4 * 4, 15 * 4},  // 35
+	{19 * 4, 23*4 - 1, 9 * 4},  // 36
+	{16 * 4, 28 * 4, 10 * 4},   // 37
+	{4 * 4, 23 * 4, 28 * 4},    // 38
+	{17 * 4, 22 * 4, 2 * 4},    // 39
+	{4 * 4, 0 * 4, 2 * 4},      // 40, Left + A
+	{4 * 4, 28 * 4, 3 * 4},     // 41
+	{28 * 4, 3 * 4, 0 * 4},     // 42
+	{3 * 4, 28 * 4, 4 * 4},     // 43, Up + A
+	{21 * 4, 28 * 4, 4 * 4},    // 44
+	{3 * 4, 28 * 4, 0 * 4},     // 45
+	{25 * 4, 3 * 4, 28 * 4},    // 46
+	{0 * 4, 28 * 4, 8 * 4},     // 47
+	{4 * 4, 3 * 4, 28 * 4},     // 48, Left
+	{28 * 4, 3 * 4, 6 * 4},     // 49, Down + B
+	{4 * 4, 28 * 4, 29 * 4},    // 50
+}
+
+// Combinations selected by holding a direction (and A or B) during boot
+var cgbKeys = map[string]int{
+	"cgb-up":      5,
+	"cgb-up-a":    43,
+	"cgb-up-b":    28,
+	"cgb-left":    48,
+	"cgb-left-a":  40,
+	"cgb-left-b":  7,
+	"cgb-down":    8,
+	"cgb-down-a":  3,
+	"cgb-down-b":  49,
+	"cgb-right":   1,
+	"cgb-right-a": 0,
+	"cgb-right-b": 6,
+}
+
+type cgbTitle struct {
+	checksum byte
+	// 4th letter of the title, for checksums shared by several games
+	letter      byte
+	combination int
+}
+
+// Games published by Nintendo which the CGB boot ROM recognizes from their
+// title checksum, in the order it looks them up
+var cgbTitles = [...]cgbTitle{
+	{0x88, 0, 4},  // ALLEY WAY
+	{0x16, 0, 5},  // YAKUMAN
+	{0x36, 0, 35}, // BASEBALL, (Game and Watch 2)
+	{0xd1, 0, 34}, // TENNIS
+	{0xdb, 0, 3},  // TETRIS
+	{0xf2, 0, 31}, // QIX
+	{0x3c, 0, 15}, // DR.MARIO
+	{0x8c, 0, 10}, // RADARMISSION
+	{0x92, 0, 5},  // F1RACE
+	{0x3d, 0, 19}, // YOSSY NO TAMAGO
+	{0x5c, 0, 36},
+	{0x58, 0, 7},  // X
+	{0xc9, 0, 37}, // MARIOLAND2
+	{0x3e, 0, 30}, // YOSSY NO COOKIE
+	{0x70, 0, 44}, // ZELDA
+	{0x1d, 0, 21},
+	{0x59, 0, 32},
+	{0x69, 0, 31}, // TETRIS FLASH
+	{0x19, 0, 20}, // DONKEY KONG
+	{0x35, 0, 5},  // MARIO'S PICROSS
+	{0xa8, 0, 33},
+	{0x14, 0, 13}, // POKEMON RED, (GAMEBOYCAMERA G)
+	{0xaa, 0, 14}, // POKEMON GREEN
+	{0x75, 0, 5},  // PICROSS 2
+	{0x95, 0, 29}, // YOSSY NO PANEPON
+	{0x99, 0, 5},  // KIRAKIRA KIDS
+	{0x34, 0, 18}, // GAMEBOY GALLERY
+	{0x6f, 0, 9},  // POCKETCAMERA
+	{0x15, 0, 3},
+	{0xff, 0, 2},  // BALLOON KID
+	{0x97, 0, 26}, // KINGOFTHEZOO
+	{0x4b, 0, 25}, // DMG FOOTBALL
+	{0x90, 0, 25}, // WORLD CUP
+	{0x17, 0, 41}, // OTHELLO
+	{0x10, 0, 42}, // SUPER RC PRO-AM
+	{0x39, 0, 26}, // DYNABLASTER
+	{0xf7, 0, 45}, // BOY AND BLOB GB2
+	{0xf6, 0, 42}, // MEGAMAN
+	{0xa2, 0, 45}, // STAR WARS-NOA
+	{0x49, 0, 36},
+	{0x4e, 0, 38}, // WAVERACE
+	{0x43, 0, 26},
+	{0x68, 0, 42}, // LOLO2
+	{0xe0, 0, 30}, // YOSHI'S COOKIE
+	{0x8b, 0, 41}, // MYSTIC QUEST
+	{0xf0, 0, 34},
+	{0xce, 0, 34}, // TOPRANKINGTENNIS
+	{0x0c, 0, 5},  // MANSELL
+	{0x29, 0, 42}, // MEGAMAN3
+	{0xe8, 0, 6},  // SPACE INVADERS
+	{0xb7, 0, 5},  // GAME&WATCH
+	{0x86, 0, 33}, // DONKEYKONGLAND95
+	{0x9a, 0, 25}, // ASTEROIDS/MISCMD
+	{0x52, 0, 42}, // STREET FIGHTER 2
+	{0x01, 0, 42}, // DEFENDER/JOUST
+	{0x9d, 0, 40}, // KILLERINSTINCT95
+	{0x71, 0, 2},  // TETRIS BLAST
+	{0x9c, 0, 16}, // PINOCCHIO
+	{0xbd, 0, 25},
+	{0x5d, 0, 42}, // BA.TOSHINDEN
+	{0x6d, 0, 42}, // NETTOU KOF 95
+	{0x67, 0, 5},
+	{0x3f, 0, 0},  // TETRIS PLUS
+	{0x6b, 0, 39}, // DONKEYKONGLAND 3
+	{0xb3, 'B', 36},
+	{0x46, 'E', 22}, // SUPER MARIOLAND
+	{0x28, 'F', 25}, // GOLF
+	{0xa5, 'A', 6},  // SOLARSTRIKER
+	{0xc6, 'A', 32}, // GBWARS
+	{0xd3, 'R', 12}, // KAERUNOTAMENI
+	{0x27, 'B', 36},
+	{0x61, 'E', 11}, // POKEMON BLUE
+	{0x18, 'K', 39}, // DONKEYKONGLAND
+	{0x66, 'E', 18}, // GAMEBOY GALLERY2
+	{0x6a, 'K', 39}, // DONKEYKONGLAND 2
+	{0xbf, ' ', 24}, // KID ICARUS
+	{0x0d, 'R', 31}, // TETRIS2
+	{0xf4, '-', 50},
+	{0xb3, 'U', 17}, // MOGURANYA
+	{0x46, 'R', 46},
+	{0x28, 'A', 6},  // GALAGA&GALAXIAN
+	{0xa5, 'R', 27}, // BT2RAGNAROKWORLD
+	{0xc6, ' ', 0},  // KEN GRIFFEY JR
+	{0xd3, 'I', 47},
+	{0x27, 'N', 41}, // MAGNETIC SOCCER
+	{0x61, 'A', 41}, // VEGAS STAKES
+	{0x18, 'I', 0},
+	{0x66, 'L', 0},  // MILLI/CENTI/PEDE
+	{0x6a, 'I', 19}, // MARIO & YOSHI
+	{0xbf, 'C', 34}, // SOCCER
+	{0x0d, 'E', 23}, // POKEBOM
+	{0xf4, ' ', 18}, // G&W GALLERY
+	{0xb3, 'R', 29}, // TETRIS ATTACK
+}
+
+func init() {
+	for name, combination := range cgbKeys {
+		Presets[name] = cgbPalettes(combination)
+	}
+}
+
+// cgbPalettes builds the palettes of a combination.
+func cgbPalettes(combination int) ppu.Palettes {
+	indexes := cgbCombinations[combination]
+
+	return ppu.Palettes{
+		OBJ0: cgbPalette(indexes[0]),
+		OBJ1: cgbPalette(indexes[1]),
+		BG:   cgbPalette(indexes[2]),
+	}
+}
+
+func cgbPalette(index int) ppu.Palette {
+	var palette ppu.Palette
+
+	for i := range palette {
+		color := cgbColors[index+i]
+
+		// The 5-bit components are stored from the red one, in the low bits.
+		for j := range palette[i] {
+			component := int(color>>uint(5*j)) & 0x1f
+			palette[i][j] = byte((component*255 + 15) / 31)
+		}
+	}
+
+	return palette
+}
+
+// ForCGB returns the palettes picked by the CGB boot ROM for a DMG game. The
+// games published by Nintendo are looked up by title checksum (and by the
+// title's 4th letter if several games share their checksum), the other ones
+// getting the first combination.
+func ForCGB(header *cartridge.Header) ppu.Palettes {
+	combination := 0
+
+	if header.Nintendo() {
+		checksum := header.TitleChecksum()
+
+		for _, title := range cgbTitles {
+			if title.checksum == checksum && (title.letter == 0 || title.letter == header.Title[3]) {
+				combination = title.combination
+				break
+			}
+		}
+	}
+
+	return cgbPalettes(combination)
+}
@@ -0,0 +1,92 @@
+package palette
+
+import (
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// Green approximates the shades of the original DMG screen.
+var Green = ppu.Palette{
+	{155, 188, 15},
+	{139, 172, 15},
+	{48, 98, 48},
+	{15, 56, 15},
+}
+
+// SGB is the palette used by the Super Game Boy until a game sets its own.
+var SGB = ppu.Palette{
+	{247, 231, 198},
+	{214, 142, 73},
+	{166, 53, 33},
+	{51, 30, 80},
+}
+
+// Presets holds the built-in palettes. The "cgb-" ones, added from the CGB
+// boot ROM's combinations, are named after the keys selecting them.
+var Presets = map[string]ppu.Palettes{
+	"gray":  single(ppu.Colors),
+	"green": single(Green),
+	"sgb":   single(SGB),
+}
+
+func single(palette ppu.Palette) ppu.Palettes {
+	return ppu.Palettes{
+		BG:   palette,
+		OBJ0: palette,
+		OBJ1: palette,
+	}
+}
+
+// Parse builds a palette from four colors formatted as "#rrggbb", from the
+// lightest one.
+func Parse(shades []string) (ppu.Palette, error) {
+	var palette ppu.Palette
+
+	if len(shades) != len(palette) {
+		return palette, fmt.Errorf("Palettes are made of %d colors", len(palette))
+	}
+
+	for i, shade := range shades {
+		rgb, err := hex.DecodeString(strings.TrimPrefix(shade, "#"))
+		if err != nil || len(rgb) != 3 {
+			return palette, fmt.Errorf("Invalid color: %s", shade)
+		}
+
+		copy(palette[i][:], rgb)
+	}
+
+	return palette, nil
+}
+
+// Custom builds the palettes of a user palette, the sprites' ones defaulting
+// to the background one.
+func Custom(bg, obj0, obj1 []string) (ppu.Palettes, error) {
+	var palettes ppu.Palettes
+
+	var err error
+	palettes.BG, err = Parse(bg)
+	if err != nil {
+		return palettes, err
+	}
+
+	palettes.OBJ0, palettes.OBJ1 = palettes.BG, palettes.BG
+
+	if obj0 != nil {
+		palettes.OBJ0, err = Parse(obj0)
+		if err != nil {
+			return palettes, err
+		}
+	}
+
+	if obj1 != nil {
+		palettes.OBJ1, err = Parse(obj1)
+		if err != nil {
+			return palettes, err
+		}
+	}
+
+	return palettes, nil
+}
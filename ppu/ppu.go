@@ -1,8 +1,12 @@
 package ppu
 
 import (
+	"encoding/binary"
+	"io"
+
 	"github.com/bovarysme/bmo/interrupt"
 	"github.com/bovarysme/bmo/mmu"
+	"github.com/bovarysme/bmo/model"
 )
 
 // PPU registers' addresses
@@ -54,6 +58,12 @@ const (
 	bufferSize = ScreenWidth * ScreenHeight * ColorDepth
 )
 
+const (
+	lineCycles  = 114
+	frameLines  = 154
+	frameCycles = lineCycles * frameLines
+)
+
 const (
 	tileWidth     = 8
 	tileHeight    = 8
@@ -61,13 +71,25 @@ const (
 	tileMapHeight = 32
 )
 
-var Colors = [4][3]byte{
+// Palette holds the RGB colors of the four shades, from the lightest one.
+type Palette [4][3]byte
+
+// Colors is the default palette, the gray shades of the Game Boy Pocket.
+var Colors = Palette{
 	{255, 255, 255}, // White
 	{169, 169, 169}, // Light gray
 	{54, 54, 54},    // Dark gray
 	{0, 0, 0},       // Black
 }
 
+// Palettes holds the palettes used for the background and window, and for
+// the sprites using OBP0 and OBP1.
+type Palettes struct {
+	BG   Palette
+	OBJ0 Palette
+	OBJ1 Palette
+}
+
 type Sprite struct {
 	x           byte
 	y           byte
@@ -80,8 +102,16 @@ type Sprite struct {
 
 type PPU struct {
 	Pixels []byte
+	// Shade (0 to 3) of each pixel, which the Super Game Boy colorizes
+	Shades []byte
 	VBlank bool
 
+	// Lenient lets the CPU access VRAM and OAM regardless of the current
+	// mode, which helps when debugging homebrew ROMs.
+	Lenient bool
+	// Palettes used to render the shades
+	Palettes Palettes
+
 	ic  *interrupt.IC
 	mmu *mmu.MMU
 
@@ -94,11 +124,18 @@ type PPU struct {
 	cycles  int
 	mode    byte
 	sprites []Sprite
+
+	enabled bool
+	// The first frame after the LCD is turned on isn't displayed.
+	skipFrame bool
 }
 
 func NewPPU(mmu *mmu.MMU, ic *interrupt.IC) *PPU {
 	return &PPU{
 		Pixels: make([]byte, bufferSize),
+		Shades: make([]byte, ScreenWidth*ScreenHeight),
+
+		Palettes: Palettes{Colors, Colors, Colors},
 
 		mode: OAMSearch,
 
@@ -111,16 +148,53 @@ func NewPPU(mmu *mmu.MMU, ic *interrupt.IC) *PPU {
 
 func (p *PPU) Step(cycles int) {
 	if !p.hasFlags(LCDC, LCDEnable) {
+		if p.enabled {
+			p.disable()
+		}
+
+		// Keep emitting blank frames while the LCD is off so that the
+		// frontend stays responsive.
+		p.cycles += cycles
+		if p.cycles >= frameCycles {
+			p.cycles -= frameCycles
+			p.VBlank = true
+		}
+
 		return
 	}
 
+	if !p.enabled {
+		p.enable()
+	}
+
 	p.updateMode()
 	p.updateLine()
 
 	p.cycles += cycles
 }
 
+// ReadByte reads a byte on behalf of the CPU, which can't access VRAM during
+// pixel transfer nor OAM during OAM search and pixel transfer.
 func (p *PPU) ReadByte(address uint16) byte {
+	if p.isLocked(address) {
+		return 0xff
+	}
+
+	return p.PeekByte(address)
+}
+
+// WriteByte writes a byte on behalf of the CPU, ignoring writes to locked
+// VRAM and OAM.
+func (p *PPU) WriteByte(address uint16, value byte) {
+	if p.isLocked(address) {
+		return
+	}
+
+	p.PokeByte(address, value)
+}
+
+// PeekByte reads a byte regardless of the VRAM and OAM access restrictions.
+func (p *PPU) PeekByte(address uint16) byte {
 	var value byte
 
 	switch {
@@ -139,7 +213,8 @@ func (p *PPU) ReadByte(address uint16) byte {
 	return value
 }
 
-func (p *PPU) WriteByte(address uint16, value byte) {
+// PokeByte writes a byte regardless of the VRAM and OAM access restrictions.
+func (p *PPU) PokeByte(address uint16, value byte) {
 	switch {
 	case address >= mmu.VRAMStart && address <= mmu.VRAMEnd:
 		address -= mmu.VRAMStart
@@ -151,6 +226,121 @@ func (p *PPU) WriteByte(address uint16, value byte) {
 	}
 }
 
+func (p *PPU) isLocked(address uint16) bool {
+	if p.Lenient || !p.enabled {
+		return false
+	}
+
+	switch {
+	case address >= mmu.VRAMStart && address <= mmu.VRAMEnd:
+		return p.mode == PixelTransfer
+	case address >= mmu.OAMRAMStart && address <= mmu.UnusableEnd:
+		return p.mode == OAMSearch || p.mode == PixelTransfer
+	}
+
+	return false
+}
+
+// Registered trademark symbol drawn by the boot ROM after the logo
+var trademark = [8]byte{0x3c, 0x42, 0xb9, 0xa5, 0xb9, 0xa5, 0x42, 0x3c}
+
+// Line on which the boot ROMs hand over, the DMG0 one being faster than the
+// DMG one. The SGB and CGB ones aren't known, and are assumed to be the DMG
+// one.
+var postBootLines = map[model.Model]byte{
+	model.DMG0: 0x91,
+	model.DMG:  frameLines - 1,
+	model.MGB:  frameLines - 1,
+	model.SGB:  frameLines - 1,
+	model.SGB2: frameLines - 1,
+	model.CGB:  frameLines - 1,
+}
+
+// SkipBoot puts the PPU in the state left by a model's boot ROM: the LCD is
+// on, in VBlank at the end of the line the boot ROM hands over on, and the
+// Nintendo logo from the cartridge header is in VRAM (except on the CGB,
+// whose boot ROM draws its own logo and clears it).
+func (p *PPU) SkipBoot(m model.Model) {
+	p.enabled = true
+	p.ly = postBootLines[m]
+	p.cycles = lineCycles - 1
+	p.setMode(VBlank)
+
+	if m.IsCGB() {
+		return
+	}
+
+	// Each nibble of the logo is scaled up to two rows of 8 pixels.
+	address := uint16(mmu.VRAMStart + 0x10)
+	for i := uint16(0); i < 48; i++ {
+		value := p.mmu.ReadByte(0x104 + i)
+
+		for _, nibble := range [2]byte{value >> 4, value & 0xf} {
+			var row byte
+			for bit := uint(0); bit < 4; bit++ {
+				if nibble>>bit&1 == 1 {
+					row |= 3 << (bit * 2)
+				}
+			}
+
+			p.PokeByte(address, row)
+			p.PokeByte(address+2, row)
+			address += 4
+		}
+	}
+
+	for _, row := range trademark {
+		p.PokeByte(address, row)
+		address += 2
+	}
+
+	// The logo's tiles are displayed on two rows, the trademark symbol at
+	// the end of the first one.
+	for i := uint16(0); i < 12; i++ {
+		p.PokeByte(0x9904+i, byte(i+1))
+		p.PokeByte(0x9924+i, byte(i+13))
+	}
+	p.PokeByte(0x9910, 25)
+}
+
+// disable resets LY and the STAT mode when the LCD is turned off, and blanks
+// the screen.
+func (p *PPU) disable() {
+	p.enabled = false
+
+	p.ly = 0
+	p.cycles = 0
+	p.setMode(HBlank)
+
+	for i := 0; i < bufferSize; i += ColorDepth {
+		p.Pixels[i] = p.Palettes.BG[0][0]
+		p.Pixels[i+1] = p.Palettes.BG[0][1]
+		p.Pixels[i+2] = p.Palettes.BG[0][2]
+	}
+	for i := range p.Shades {
+		p.Shades[i] = 0
+	}
+	p.VBlank = true
+}
+
+func (p *PPU) enable() {
+	p.enabled = true
+	p.skipFrame = true
+
+	// Restart from the beginning of line 0 so that the next mode update
+	// triggers an OAM search.
+	p.cycles = 0
+	p.mode = HBlank
+}
+
+func (p *PPU) setMode(mode byte) {
+	p.mode = mode
+
+	stat := p.mmu.ReadByte(STAT)
+	stat = stat&^Mode | mode
+	p.mmu.WriteByte(STAT, stat)
+}
+
 func (p *PPU) updateMode() {
 	var mode byte
 
@@ -165,30 +355,32 @@ func (p *PPU) updateMode() {
 	}
 
 	if mode != p.mode {
-		p.mode = mode
-
-		stat := p.mmu.ReadByte(STAT)
-		stat = stat&^Mode | mode
-		p.mmu.WriteByte(STAT, stat)
+		p.setMode(mode)
 
 		switch mode {
 		case OAMSearch:
 			p.oamSearch()
 		case PixelTransfer:
-			p.transferLine()
+			if !p.skipFrame {
+				p.transferLine()
+			}
 		case VBlank:
-			p.VBlank = true
+			if p.skipFrame {
+				p.skipFrame = false
+			} else {
+				p.VBlank = true
+			}
 			p.ic.Request(interrupt.VBlank)
 		}
 	}
 }
 
 func (p *PPU) updateLine() {
-	if p.cycles >= 114 {
+	if p.cycles >= lineCycles {
 		p.cycles = 0
 
 		p.ly++
-		if p.ly >= 154 {
+		if p.ly >= frameLines {
 			p.ly = 0
 		}
 
@@ -211,15 +403,15 @@ func (p *PPU) oamSearch() {
 	}
 
 	for address := uint16(mmu.OAMRAMStart); address <= mmu.OAMRAMEnd; address += 4 {
-		y := p.ReadByte(address)
-		x := p.ReadByte(address + 1)
+		y := p.PeekByte(address)
+		x := p.PeekByte(address + 1)
 
 		if x == 0 || p.ly+16 < y || p.ly+16 >= y+spriteHeight {
 			continue
 		}
 
-		tileNumber := p.ReadByte(address + 2)
-		flags := p.ReadByte(address + 3)
+		tileNumber := p.PeekByte(address + 2)
+		flags := p.PeekByte(address + 3)
 
 		var palette uint16 = OBP0
 		if flags>>4&1 == 1 {
@@ -283,13 +475,14 @@ func (p *PPU) transferBGOrWindow(mapMask, mapLine byte, mapColumn, start int) {
 	mapOffset := mapAddress + uint16(mapLine)/tileHeight*tileMapWidth
 
 	palette := p.decodePalette(BGP)
+	colors := p.Palettes.BG
 
 	for i := start; i < ScreenWidth; i += tileWidth {
 		// XXX
 		var temp byte = byte(i) + byte(mapColumn)
 		address := mapOffset + uint16(temp)/tileWidth
 
-		var tileNumber uint16 = uint16(p.mmu.ReadByte(address))
+		var tileNumber uint16 = uint16(p.PeekByte(address))
 		if dataAddress == 0x8800 {
 			tileNumber = uint16(int8(tileNumber)) + 128
 		}
@@ -297,8 +490,8 @@ func (p *PPU) transferBGOrWindow(mapMask, mapLine byte, mapColumn, start int) {
 		// Tile data = 16 bytes
 		dataOffset := dataAddress + tileNumber*16 + uint16(mapLine)%tileHeight*2
 
-		low := p.ReadByte(dataOffset)
-		high := p.ReadByte(dataOffset + 1)
+		low := p.PeekByte(dataOffset)
+		high := p.PeekByte(dataOffset + 1)
 
 		for j := 0; j < tileWidth; j++ {
 			x := i + j
@@ -308,8 +501,10 @@ func (p *PPU) transferBGOrWindow(mapMask, mapLine byte, mapColumn, start int) {
 
 			// TODO: simplify
 			colorNumber := high>>(7-byte(j))&1<<1 | low>>(7-byte(j))&1
-			color := Colors[palette[colorNumber]]
+			shade := palette[colorNumber]
+			color := colors[shade]
 
+			p.Shades[ScreenWidth*int(p.ly)+x] = shade
 			index := Pitch*int(p.ly) + ColorDepth*x
 			p.Pixels[index] = color[0]
 			p.Pixels[index+1] = color[1]
@@ -327,6 +522,10 @@ func (p *PPU) transferSprite() {
 
 	for _, sprite := range p.sprites {
 		palette := p.decodePalette(sprite.palette)
+		colors := p.Palettes.OBJ0
+		if sprite.palette == OBP1 {
+			colors = p.Palettes.OBJ1
+		}
 
 		// XXX
 		dataOffset := 0x8000 + uint16(sprite.tileNumber)*16
@@ -336,8 +535,8 @@ func (p *PPU) transferSprite() {
 			dataOffset += uint16((p.ly-sprite.y)%spriteHeight) * 2
 		}
 
-		low := p.ReadByte(dataOffset)
-		high := p.ReadByte(dataOffset + 1)
+		low := p.PeekByte(dataOffset)
+		high := p.PeekByte(dataOffset + 1)
 
 		for j := 0; j < 8; j++ {
 			// XXX
@@ -357,8 +556,10 @@ func (p *PPU) transferSprite() {
 				continue
 			}
 
-			color := Colors[palette[colorNumber]]
+			shade := palette[colorNumber]
+			color := colors[shade]
 
+			p.Shades[ScreenWidth*int(p.ly)+x] = shade
 			index := Pitch*int(p.ly) + ColorDepth*x
 			p.Pixels[index] = color[0]
 			p.Pixels[index+1] = color[1]
@@ -383,3 +584,68 @@ func (p *PPU) decodePalette(address uint16) [4]byte {
 
 	return palette
 }
+
+type ppuState struct {
+	Pixels [bufferSize]byte
+	Shades [ScreenWidth * ScreenHeight]byte
+	VBlank bool
+
+	VRAM   [mmu.VRAMSize]byte
+	OAMRAM [mmu.OAMRAMSize]byte
+
+	LY     byte
+	Cycles int32
+	Mode   byte
+
+	Enabled   bool
+	SkipFrame bool
+}
+
+func (p *PPU) SaveState(w io.Writer) error {
+	state := ppuState{
+		VBlank: p.VBlank,
+
+		VRAM:   p.vram,
+		OAMRAM: p.oamRAM,
+
+		LY:     p.ly,
+		Cycles: int32(p.cycles),
+		Mode:   p.mode,
+
+		Enabled:   p.enabled,
+		SkipFrame: p.skipFrame,
+	}
+	copy(state.Pixels[:], p.Pixels)
+	copy(state.Shades[:], p.Shades)
+
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (p *PPU) LoadState(r io.Reader) error {
+	var state ppuState
+
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+
+	copy(p.Pixels, state.Pixels[:])
+	copy(p.Shades, state.Shades[:])
+	p.VBlank = state.VBlank
+
+	p.vram = state.VRAM
+	p.oamRAM = state.OAMRAM
+
+	p.ly = state.LY
+	p.cycles = int(state.Cycles)
+	p.mode = state.Mode
+
+	p.enabled = state.Enabled
+	p.skipFrame = state.SkipFrame
+
+	// OAM can't be written during pixel transfer, so the sprites of the
+	// current line can be found again.
+	p.oamSearch()
+
+	return nil
+}
@@ -0,0 +1,241 @@
+package screen
+
+import (
+	"encoding/binary"
+	"fmt"
+
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// filter scales a frame up on the CPU, by a fixed factor.
+type filter struct {
+	scale int
+	apply func(dst, src []byte, width, height int)
+}
+
+// Filters which can be applied to the frames, by name
+var filters = map[string]filter{
+	"none":    {1, nil},
+	"scale2x": {2, scale2x},
+	"scale3x": {3, scale3x},
+	"lcd":     {3, lcdGrid},
+}
+
+func parseFilter(name string) (filter, error) {
+	f, ok := filters[name]
+	if !ok {
+		return f, fmt.Errorf("Unknown filter: %s", name)
+	}
+
+	return f, nil
+}
+
+// Filter blends and scales the frames as set in the options, before they're
+// displayed.
+type Filter struct {
+	width  int
+	height int
+
+	filter filter
+	// Filtered frame
+	scaled []byte
+
+	blend    bool
+	previous []byte
+	blended  []byte
+}
+
+func NewFilter(width, height int, options Options) (*Filter, error) {
+	f, err := parseFilter(options.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	size := width * height * ppu.ColorDepth
+
+	return &Filter{
+		width:  width,
+		height: height,
+
+		filter: f,
+		scaled: make([]byte, size*f.scale*f.scale),
+
+		blend:    options.Blend,
+		previous: make([]byte, size),
+		blended:  make([]byte, size),
+	}, nil
+}
+
+// Scale returns the factor by which the frames are scaled up.
+func (f *Filter) Scale() int {
+	return f.filter.scale
+}
+
+// Apply returns the filtered frame, which is overwritten by the next call.
+func (f *Filter) Apply(pixels []byte) []byte {
+	if f.blend {
+		blend(f.blended, pixels, f.previous)
+		copy(f.previous, pixels)
+		pixels = f.blended
+	}
+
+	if f.filter.apply != nil {
+		f.filter.apply(f.scaled, pixels, f.width, f.height)
+		pixels = f.scaled
+	}
+
+	return pixels
+}
+
+// frame reads and writes the colors of a frame as 32-bit values, the padding
+// byte being ignored.
+type frame struct {
+	pixels []byte
+	width  int
+	height int
+}
+
+// at returns the color of a pixel, the edges being repeated past the frame.
+func (f frame) at(x, y int) uint32 {
+	if x < 0 {
+		x = 0
+	} else if x >= f.width {
+		x = f.width - 1
+	}
+
+	if y < 0 {
+		y = 0
+	} else if y >= f.height {
+		y = f.height - 1
+	}
+
+	index := (y*f.width + x) * ppu.ColorDepth
+	return binary.LittleEndian.Uint32(f.pixels[index:]) & 0xffffff
+}
+
+func (f frame) set(x, y int, color uint32) {
+	index := (y*f.width + x) * ppu.ColorDepth
+	binary.LittleEndian.PutUint32(f.pixels[index:], color)
+}
+
+// scale2x doubles the frame, rounding the diagonals (the EPX algorithm).
+func scale2x(dst, src []byte, width, height int) {
+	in := frame{src, width, height}
+	out := frame{dst, width * 2, height * 2}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			b, d, e := in.at(x, y-1), in.at(x-1, y), in.at(x, y)
+			f, h := in.at(x+1, y), in.at(x, y+1)
+
+			e0, e1, e2, e3 := e, e, e, e
+			if b != h && d != f {
+				if d == b {
+					e0 = d
+				}
+				if b == f {
+					e1 = f
+				}
+				if d == h {
+					e2 = d
+				}
+				if h == f {
+					e3 = f
+				}
+			}
+
+			out.set(x*2, y*2, e0)
+			out.set(x*2+1, y*2, e1)
+			out.set(x*2, y*2+1, e2)
+			out.set(x*2+1, y*2+1, e3)
+		}
+	}
+}
+
+// scale3x triples the frame, like scale2x.
+func scale3x(dst, src []byte, width, height int) {
+	in := frame{src, width, height}
+	out := frame{dst, width * 3, height * 3}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			a, b, c := in.at(x-1, y-1), in.at(x, y-1), in.at(x+1, y-1)
+			d, e, f := in.at(x-1, y), in.at(x, y), in.at(x+1, y)
+			g, h, i := in.at(x-1, y+1), in.at(x, y+1), in.at(x+1, y+1)
+
+			cell := [9]uint32{e, e, e, e, e, e, e, e, e}
+			if b != h && d != f {
+				if d == b {
+					cell[0] = d
+				}
+				if (d == b && e != c) || (b == f && e != a) {
+					cell[1] = b
+				}
+				if b == f {
+					cell[2] = f
+				}
+				if (d == b && e != g) || (d == h && e != a) {
+					cell[3] = d
+				}
+				if (b == f && e != i) || (h == f && e != c) {
+					cell[5] = f
+				}
+				if d == h {
+					cell[6] = d
+				}
+				if (d == h && e != i) || (h == f && e != g) {
+					cell[7] = h
+				}
+				if h == f {
+					cell[8] = f
+				}
+			}
+
+			for j, color := range cell {
+				out.set(x*3+j%3, y*3+j/3, color)
+			}
+		}
+	}
+}
+
+// lcdGrid triples the frame, darkening the right and bottom edges of each
+// pixel to draw the grid between the LCD's dots.
+func lcdGrid(dst, src []byte, width, height int) {
+	in := frame{src, width, height}
+	out := frame{dst, width * 3, height * 3}
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			color := in.at(x, y)
+			edge := darken(color)
+
+			for j := 0; j < 9; j++ {
+				c := color
+				if j%3 == 2 || j/3 == 2 {
+					c = edge
+				}
+
+				out.set(x*3+j%3, y*3+j/3, c)
+			}
+		}
+	}
+}
+
+// darken scales the components of a color by 3/4.
+func darken(color uint32) uint32 {
+	var result uint32
+	for shift := uint(0); shift < 24; shift += 8 {
+		component := color >> shift & 0xff
+		result |= component * 3 / 4 << shift
+	}
+
+	return result
+}
+
+// blend mixes a frame with the previous one, which emulates the ghosting of
+// the LCD that some games rely on for transparency effects.
+func blend(dst, current, previous []byte) {
+	for i := range dst {
+		dst[i] = byte((int(current[i]) + int(previous[i]) + 1) / 2)
+	}
+}
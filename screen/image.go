@@ -0,0 +1,57 @@
+package screen
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"image"
+	"image/png"
+	"os"
+
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// Image converts a frame to an image.
+func Image(pixels []byte) *image.RGBA {
+	return ImageSize(pixels, ppu.ScreenWidth, ppu.ScreenHeight)
+}
+
+// ImageSize converts a frame of any size (e.g. a Super Game Boy's bordered
+// frame) to an image.
+func ImageSize(pixels []byte, width, height int) *image.RGBA {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			src := (y*width + x) * ppu.ColorDepth
+			dst := img.PixOffset(x, y)
+
+			copy(img.Pix[dst:dst+3], pixels[src:src+3])
+			img.Pix[dst+3] = 0xff
+		}
+	}
+
+	return img
+}
+
+// SavePNG writes a frame to a PNG file.
+func SavePNG(pixels []byte, path string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return png.Encode(file, Image(pixels))
+}
+
+// Hash returns a hash of a frame's colors, which stays the same across runs
+// and platforms.
+func Hash(pixels []byte) string {
+	hash := sha256.New()
+
+	for i := 0; i < len(pixels); i += ppu.ColorDepth {
+		hash.Write(pixels[i : i+3])
+	}
+
+	return hex.EncodeToString(hash.Sum(nil))
+}
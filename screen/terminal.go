@@ -0,0 +1,130 @@
+package screen
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// TerminalScreen draws frames in a terminal supporting 24-bit colors, two
+// pixels per character: the upper half block takes the color of the top
+// pixel, and the background the one of the bottom pixel.
+type TerminalScreen struct {
+	tty    *os.File
+	writer *bufio.Writer
+
+	width  int
+	height int
+
+	// Colors of the cells drawn by the previous frame, which are only drawn
+	// again when they change
+	cells []cell
+	drawn bool
+}
+
+type cell struct {
+	top    [3]byte
+	bottom [3]byte
+}
+
+// NewTerminalScreen puts the controlling terminal in raw mode, so that it
+// can also be read from by the terminal keys, and draws frames of the given
+// size on it.
+func NewTerminalScreen(width, height int) (*TerminalScreen, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	err = stty(tty, "raw", "-echo")
+	if err != nil {
+		tty.Close()
+		return nil, err
+	}
+
+	screen := &TerminalScreen{
+		tty:    tty,
+		writer: bufio.NewWriterSize(tty, 1<<16),
+
+		width:  width,
+		height: height,
+
+		cells: make([]cell, width*(height+1)/2),
+	}
+
+	// Switching to the alternate screen and hiding the cursor
+	screen.writer.WriteString("\x1b[?1049h\x1b[?25l\x1b[2J")
+
+	return screen, screen.writer.Flush()
+}
+
+// Input returns the terminal, from which the keys are read.
+func (t *TerminalScreen) Input() io.Reader {
+	return t.tty
+}
+
+func (t *TerminalScreen) Render(pixels []byte) error {
+	// Position of the cursor and current colors, to avoid setting them
+	// again for the next cell drawn
+	row, column := -1, -1
+	var colors *cell
+
+	for y := 0; y < t.height; y += 2 {
+		for x := 0; x < t.width; x++ {
+			var c cell
+
+			index := y*t.width*ppu.ColorDepth + x*ppu.ColorDepth
+			copy(c.top[:], pixels[index:index+3])
+			if y+1 < t.height {
+				index += t.width * ppu.ColorDepth
+				copy(c.bottom[:], pixels[index:index+3])
+			}
+
+			i := y/2*t.width + x
+			if t.drawn && t.cells[i] == c {
+				continue
+			}
+			t.cells[i] = c
+
+			if row != y/2 || column != x {
+				fmt.Fprintf(t.writer, "\x1b[%d;%dH", y/2+1, x+1)
+			}
+
+			if colors == nil || colors.top != c.top {
+				fmt.Fprintf(t.writer, "\x1b[38;2;%d;%d;%dm", c.top[0], c.top[1], c.top[2])
+			}
+			if colors == nil || colors.bottom != c.bottom {
+				fmt.Fprintf(t.writer, "\x1b[48;2;%d;%d;%dm", c.bottom[0], c.bottom[1], c.bottom[2])
+			}
+
+			t.writer.WriteString("▀")
+			row, column, colors = y/2, x+1, &t.cells[i]
+		}
+	}
+
+	t.drawn = true
+
+	return t.writer.Flush()
+}
+
+// Shutdown restores the terminal's colors, cursor, screen and mode.
+func (t *TerminalScreen) Shutdown() {
+	t.writer.WriteString("\x1b[0m\x1b[?25h\x1b[?1049l")
+	t.writer.Flush()
+
+	stty(t.tty, "sane")
+	t.tty.Close()
+}
+
+// stty changes the settings of a terminal. Running the command avoids
+// depending on the system calls of each platform.
+func stty(tty *os.File, args ...string) error {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+
+	return cmd.Run()
+}
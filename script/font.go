@@ -0,0 +1,43 @@
+package script
+
+// Width and height of the glyphs, which are separated by a column
+const (
+	glyphWidth  = 3
+	glyphHeight = 5
+)
+
+// Glyphs of the overlays' font, one octal digit per row (the highest bit
+// being the leftmost pixel). Lowercase letters are drawn in uppercase, and
+// unknown characters as '?'.
+var glyphs = map[rune]uint16{
+	'0': 075557, '1': 026227, '2': 071747, '3': 071317, '4': 055711,
+	'5': 074717, '6': 074757, '7': 071111, '8': 075757, '9': 075717,
+
+	'A': 025755, 'B': 065656, 'C': 034443, 'D': 065556, 'E': 074647,
+	'F': 074644, 'G': 034553, 'H': 055755, 'I': 072227, 'J': 011152,
+	'K': 055655, 'L': 044447, 'M': 057755, 'N': 065555, 'O': 025552,
+	'P': 065644, 'Q': 025563, 'R': 065655, 'S': 034216, 'T': 072222,
+	'U': 055557, 'V': 055552, 'W': 055775, 'X': 055255, 'Y': 055222,
+	'Z': 071247,
+
+	' ': 000000, '.': 000002, ',': 000024, ':': 002020, ';': 002024,
+	'-': 000700, '+': 002720, '=': 007070, '_': 000007, '/': 011244,
+	'!': 022202, '?': 071202, '(': 012221, ')': 042224, '[': 064446,
+	']': 032223, '<': 012421, '>': 042124, '%': 051245, '#': 057575,
+	'*': 052725, '\'': 022000, '"': 055000,
+}
+
+// glyph returns whether the pixel of a character's glyph is set.
+func glyph(c rune, x, y int) bool {
+	if c >= 'a' && c <= 'z' {
+		c -= 'a' - 'A'
+	}
+
+	bits, ok := glyphs[c]
+	if !ok {
+		bits = glyphs['?']
+	}
+
+	row := bits >> uint((glyphHeight-1-y)*glyphWidth) & 7
+	return row>>uint(glyphWidth-1-x)&1 == 1
+}
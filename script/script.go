@@ -0,0 +1,337 @@
+package script
+
+import (
+	"log"
+
+	"github.com/bovarysme/bmo/beemo"
+	"github.com/bovarysme/bmo/input"
+	"github.com/bovarysme/bmo/ppu"
+
+	lua "github.com/yuin/gopher-lua"
+)
+
+// Default color of the overlays, as 0xrrggbb
+const defaultColor = 0xffffff
+
+type text struct {
+	x, y  int
+	text  string
+	color int
+}
+
+type pixel struct {
+	x, y  int
+	color int
+}
+
+// Script runs a Lua script alongside the emulator. Its main chunk runs until
+// it calls emu.frameadvance, and is resumed at the end of the next frame.
+// The callbacks it registers keep being called once it has returned.
+type Script struct {
+	bmo   *beemo.BMO
+	state *lua.LState
+
+	main   *lua.LFunction
+	thread *lua.LState
+	// Set once the main chunk has returned
+	done bool
+	// Set once the script has raised an error
+	failed bool
+
+	frameCallbacks []*lua.LFunction
+	execCallbacks  map[uint16][]*lua.LFunction
+	writeCallbacks map[uint16][]*lua.LFunction
+
+	// Drawn over the frames until the script's next frame
+	texts  []text
+	pixels []pixel
+}
+
+// Load loads a script and runs its main chunk until it first waits for a
+// frame.
+func Load(bmo *beemo.BMO, path string) (*Script, error) {
+	s := &Script{
+		bmo:   bmo,
+		state: lua.NewState(),
+
+		execCallbacks:  make(map[uint16][]*lua.LFunction),
+		writeCallbacks: make(map[uint16][]*lua.LFunction),
+	}
+
+	s.register()
+
+	main, err := s.state.LoadFile(path)
+	if err != nil {
+		s.state.Close()
+		return nil, err
+	}
+
+	s.main = main
+	s.thread, _ = s.state.NewThread()
+
+	s.setHooks()
+
+	state, err, _ := s.state.Resume(s.thread, s.main)
+	if state == lua.ResumeError {
+		s.Close()
+		return nil, err
+	}
+	s.done = state == lua.ResumeOK
+
+	log.Printf("Loaded script '%s'\n", path)
+
+	return s, nil
+}
+
+// Close stops the script.
+func (s *Script) Close() {
+	s.bmo.SetHooks(beemo.Hooks{})
+	s.state.Close()
+}
+
+// setHooks only sets the execution and memory write hooks when needed, since
+// they're called for each instruction.
+func (s *Script) setHooks() {
+	hooks := beemo.Hooks{
+		Frame:   s.frame,
+		Overlay: s.draw,
+	}
+
+	if len(s.execCallbacks) > 0 {
+		hooks.Exec = s.exec
+	}
+
+	if len(s.writeCallbacks) > 0 {
+		hooks.Write = s.write
+	}
+
+	s.bmo.SetHooks(hooks)
+}
+
+// fail reports an error raised by the script, and stops it.
+func (s *Script) fail(err error) {
+	log.Printf("Script error: %s\n", err)
+
+	s.done = true
+	s.failed = true
+	s.frameCallbacks = nil
+	s.execCallbacks = make(map[uint16][]*lua.LFunction)
+	s.writeCallbacks = make(map[uint16][]*lua.LFunction)
+	s.setHooks()
+}
+
+func (s *Script) call(fn *lua.LFunction, args ...lua.LValue) {
+	err := s.state.CallByParam(lua.P{Fn: fn, NRet: 0, Protect: true}, args...)
+	if err != nil {
+		s.fail(err)
+	}
+}
+
+func (s *Script) frame() {
+	s.texts = s.texts[:0]
+	s.pixels = s.pixels[:0]
+
+	for _, fn := range s.frameCallbacks {
+		s.call(fn)
+		if s.failed {
+			return
+		}
+	}
+
+	if s.done {
+		return
+	}
+
+	state, err, _ := s.state.Resume(s.thread, s.main)
+	switch state {
+	case lua.ResumeOK:
+		s.done = true
+	case lua.ResumeError:
+		s.fail(err)
+	}
+}
+
+func (s *Script) exec(address uint16) {
+	for _, fn := range s.execCallbacks[address] {
+		s.call(fn, lua.LNumber(address))
+		if s.failed {
+			return
+		}
+	}
+}
+
+func (s *Script) write(address uint16, value byte) {
+	for _, fn := range s.writeCallbacks[address] {
+		s.call(fn, lua.LNumber(address), lua.LNumber(value))
+		if s.failed {
+			return
+		}
+	}
+}
+
+func (s *Script) draw(pixels []byte, width, height int) {
+	set := func(x, y, color int) {
+		if x < 0 || x >= width || y < 0 || y >= height {
+			return
+		}
+
+		index := (y*width + x) * ppu.ColorDepth
+		pixels[index] = byte(color >> 16)
+		pixels[index+1] = byte(color >> 8)
+		pixels[index+2] = byte(color)
+	}
+
+	for _, p := range s.pixels {
+		set(p.x, p.y, p.color)
+	}
+
+	for _, t := range s.texts {
+		for i, c := range []rune(t.text) {
+			left := t.x + i*(glyphWidth+1)
+
+			for y := 0; y < glyphHeight; y++ {
+				for x := 0; x < glyphWidth; x++ {
+					if glyph(c, x, y) {
+						set(left+x, t.y+y, t.color)
+					}
+				}
+			}
+		}
+	}
+}
+
+// register defines the memory, joypad, emu, gui and event modules.
+func (s *Script) register() {
+	modules := map[string]map[string]lua.LGFunction{
+		"memory": {
+			"read":  s.memoryRead,
+			"write": s.memoryWrite,
+		},
+		"joypad": {
+			"set": s.joypadSet,
+		},
+		"emu": {
+			"frameadvance": s.emuFrameAdvance,
+		},
+		"gui": {
+			"text":  s.guiText,
+			"pixel": s.guiPixel,
+		},
+		"event": {
+			"onframeend":    s.eventOnFrameEnd,
+			"onexecute":     s.eventOnExecute,
+			"onmemorywrite": s.eventOnMemoryWrite,
+		},
+	}
+
+	for name, funcs := range modules {
+		s.state.SetGlobal(name, s.state.SetFuncs(s.state.NewTable(), funcs))
+	}
+}
+
+func checkAddress(L *lua.LState, n int) uint16 {
+	address := L.CheckInt(n)
+	if address < 0 || address > 0xffff {
+		L.ArgError(n, "address out of range")
+	}
+
+	return uint16(address)
+}
+
+// memory.read(address) returns the byte at an address, without side
+// effects.
+func (s *Script) memoryRead(L *lua.LState) int {
+	address := checkAddress(L, 1)
+	L.Push(lua.LNumber(s.bmo.PeekByte(address)))
+
+	return 1
+}
+
+// memory.write(address, value) writes a byte as the CPU would.
+func (s *Script) memoryWrite(L *lua.LState) int {
+	address := checkAddress(L, 1)
+	value := L.CheckInt(2)
+
+	s.bmo.PokeByte(address, byte(value))
+
+	return 0
+}
+
+// joypad.set{a = true, left = false} presses and releases buttons, which
+// keep their state until they're set again.
+func (s *Script) joypadSet(L *lua.LState) int {
+	buttons := L.CheckTable(1)
+
+	buttons.ForEach(func(key, value lua.LValue) {
+		button, err := input.ParseButton(key.String())
+		if err != nil {
+			L.ArgError(1, err.Error())
+			return
+		}
+
+		s.bmo.SetButton(button, lua.LVAsBool(value))
+	})
+
+	return 0
+}
+
+// emu.frameadvance() waits for the end of the next frame.
+func (s *Script) emuFrameAdvance(L *lua.LState) int {
+	if L != s.thread {
+		L.RaiseError("emu.frameadvance can only be called by the main chunk")
+		return 0
+	}
+
+	return L.Yield()
+}
+
+// gui.text(x, y, text[, color]) draws text over the next frames, until the
+// end of the script's next frame.
+func (s *Script) guiText(L *lua.LState) int {
+	s.texts = append(s.texts, text{
+		x:     L.CheckInt(1),
+		y:     L.CheckInt(2),
+		text:  L.CheckString(3),
+		color: L.OptInt(4, defaultColor),
+	})
+
+	return 0
+}
+
+// gui.pixel(x, y[, color]) draws a pixel, like gui.text.
+func (s *Script) guiPixel(L *lua.LState) int {
+	s.pixels = append(s.pixels, pixel{
+		x:     L.CheckInt(1),
+		y:     L.CheckInt(2),
+		color: L.OptInt(3, defaultColor),
+	})
+
+	return 0
+}
+
+// event.onframeend(fn) calls fn at the end of each frame.
+func (s *Script) eventOnFrameEnd(L *lua.LState) int {
+	s.frameCallbacks = append(s.frameCallbacks, L.CheckFunction(1))
+
+	return 0
+}
+
+// event.onexecute(address, fn) calls fn(address) before the instruction at
+// an address is executed.
+func (s *Script) eventOnExecute(L *lua.LState) int {
+	address := checkAddress(L, 1)
+	s.execCallbacks[address] = append(s.execCallbacks[address], L.CheckFunction(2))
+	s.setHooks()
+
+	return 0
+}
+
+// event.onmemorywrite(address, fn) calls fn(address, value) after the CPU
+// writes to an address.
+func (s *Script) eventOnMemoryWrite(L *lua.LState) int {
+	address := checkAddress(L, 1)
+	s.writeCallbacks[address] = append(s.writeCallbacks[address], L.CheckFunction(2))
+	s.setHooks()
+
+	return 0
+}
@@ -0,0 +1,32 @@
+package server
+
+import (
+	"github.com/bovarysme/bmo/input"
+	"github.com/bovarysme/bmo/screen"
+)
+
+// Frontend serves the web frontend on an address, in place of the emulator's
+// window.
+type Frontend struct {
+	Address string
+
+	server *Server
+}
+
+// Open starts the server. The screen options only apply to windows, since
+// the pages scale the frames themselves.
+func (f *Frontend) Open(width, height int, options screen.Options) (screen.Screen, error) {
+	s, err := NewServer(f.Address, width, height)
+	if err != nil {
+		return nil, err
+	}
+
+	f.server = s
+
+	return s, nil
+}
+
+// Keys returns the keys and the events sent by the pages.
+func (f *Frontend) Keys(joypad *input.Joypad, bindings input.Bindings) input.Keys {
+	return input.NewRemoteKeys(joypad, bindings, f.server.Keys(), f.server.Events())
+}
@@ -0,0 +1,124 @@
+package server
+
+// page displays the frames and sends the keys, named as in SDL so that the
+// configured bindings apply.
+const page = `<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<title>BMO</title>
+<style>
+body { background: #222; color: #ddd; font-family: sans-serif; text-align: center; }
+canvas { image-rendering: pixelated; image-rendering: crisp-edges; margin: 16px; }
+button { margin: 0 4px; }
+</style>
+</head>
+<body>
+<canvas id="screen" width="160" height="144"></canvas>
+<div>
+<button data-post="/pause">Pause</button>
+<button data-post="/resume">Resume</button>
+<button data-post="/reset">Reset</button>
+<button data-post="/hard-reset">Hard reset</button>
+<button data-post="/state/save">Save state</button>
+<button data-post="/state/load">Load state</button>
+<a href="/screenshot" target="_blank"><button>Screenshot</button></a>
+</div>
+<script>
+const canvas = document.getElementById("screen");
+const context = canvas.getContext("2d");
+const scale = 3;
+
+function resize(width, height) {
+	if (canvas.width !== width || canvas.height !== height) {
+		canvas.width = width;
+		canvas.height = height;
+	}
+	canvas.style.width = width * scale + "px";
+	canvas.style.height = height * scale + "px";
+}
+
+// Raw frames hold their size, their palette and a color index per pixel.
+function drawRaw(buffer) {
+	const data = new DataView(buffer);
+	const width = data.getUint16(0, true);
+	const height = data.getUint16(2, true);
+	const colors = data.getUint8(4) + 1;
+	const pixels = 5 + colors * 3;
+
+	resize(width, height);
+	const image = context.createImageData(width, height);
+	for (let i = 0; i < width * height; i++) {
+		const color = 5 + data.getUint8(pixels + i) * 3;
+		image.data[i * 4] = data.getUint8(color);
+		image.data[i * 4 + 1] = data.getUint8(color + 1);
+		image.data[i * 4 + 2] = data.getUint8(color + 2);
+		image.data[i * 4 + 3] = 255;
+	}
+	context.putImageData(image, 0, 0);
+}
+
+function drawPNG(buffer) {
+	createImageBitmap(new Blob([buffer], {type: "image/png"})).then(function(bitmap) {
+		resize(bitmap.width, bitmap.height);
+		context.drawImage(bitmap, 0, 0);
+	});
+}
+
+const format = new URLSearchParams(location.search).get("format") || "raw";
+const scheme = location.protocol === "https:" ? "wss://" : "ws://";
+const socket = new WebSocket(scheme + location.host + "/ws?format=" + format);
+socket.binaryType = "arraybuffer";
+socket.onmessage = function(event) {
+	// PNG images start with 0x89, which isn't a valid frame width's low byte.
+	if (new Uint8Array(event.data)[0] === 0x89) {
+		drawPNG(event.data);
+	} else {
+		drawRaw(event.data);
+	}
+};
+
+function sdlName(event) {
+	if (event.key.startsWith("Arrow")) {
+		return event.key.substring(5);
+	}
+
+	switch (event.key) {
+	case " ":
+		return "Space";
+	case "Enter":
+		return "Return";
+	case "Shift":
+	case "Control":
+	case "Alt":
+		const side = event.location === 2 ? "Right " : "Left ";
+		return side + (event.key === "Control" ? "Ctrl" : event.key);
+	}
+
+	return event.key.length === 1 ? event.key.toUpperCase() : event.key;
+}
+
+function sendKey(event, pressed) {
+	if (event.ctrlKey || event.metaKey || event.repeat) {
+		return;
+	}
+
+	event.preventDefault();
+	if (socket.readyState === WebSocket.OPEN) {
+		socket.send(JSON.stringify({key: sdlName(event), pressed: pressed}));
+	}
+}
+
+document.addEventListener("keydown", function(event) { sendKey(event, true); });
+document.addEventListener("keyup", function(event) { sendKey(event, false); });
+
+for (const button of document.querySelectorAll("[data-post]")) {
+	button.addEventListener("click", function() {
+		fetch(button.dataset.post, {method: "POST"});
+		button.blur();
+	});
+}
+</script>
+</body>
+</html>
+`
@@ -0,0 +1,323 @@
+package server
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"image/png"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"sync"
+
+	"github.com/bovarysme/bmo/input"
+	"github.com/bovarysme/bmo/ppu"
+	"github.com/bovarysme/bmo/screen"
+
+	"golang.org/x/net/websocket"
+)
+
+// Events triggered by the REST endpoints, which are all POST requests
+var endpoints = map[string]input.Event{
+	"/pause":      input.PauseOn,
+	"/resume":     input.PauseOff,
+	"/reset":      input.Reset,
+	"/hard-reset": input.HardReset,
+	"/state/save": input.SaveState,
+	"/state/load": input.LoadState,
+}
+
+// Server streams the frames to web pages over WebSockets, and sends their
+// keys and the REST endpoints' events back to the emulator. It's used as the
+// emulator's screen.
+type Server struct {
+	listener net.Listener
+
+	width  int
+	height int
+
+	keys   chan input.KeyEvent
+	events chan input.Event
+
+	// Held while accessing the last frame and the clients
+	mutex   sync.Mutex
+	frame   []byte
+	clients map[*client]bool
+}
+
+// client is a page which receives frames, either as PNG images or in the raw
+// format.
+type client struct {
+	ws  *websocket.Conn
+	raw bool
+	// Signaled when a new frame is available, frames being dropped if the
+	// client is too slow
+	ready chan struct{}
+}
+
+// NewServer starts serving the frontend, for frames of the given size.
+func NewServer(address string, width, height int) (*Server, error) {
+	listener, err := net.Listen("tcp", address)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Server{
+		listener: listener,
+
+		width:  width,
+		height: height,
+
+		keys:   make(chan input.KeyEvent, 64),
+		events: make(chan input.Event, 16),
+
+		frame:   make([]byte, width*height*ppu.ColorDepth),
+		clients: make(map[*client]bool),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", s.handlePage)
+	mux.Handle("/ws", websocket.Server{
+		Handshake: checkOrigin,
+		Handler:   s.handleWebSocket,
+	})
+	mux.HandleFunc("/screenshot", s.handleScreenshot)
+	for path, event := range endpoints {
+		mux.HandleFunc(path, s.handleEvent(event))
+	}
+
+	go http.Serve(listener, mux)
+
+	log.Printf("Serving the frontend on http://%s/\n", listener.Addr())
+
+	return s, nil
+}
+
+// Keys returns the keys pressed and released on the pages.
+func (s *Server) Keys() <-chan input.KeyEvent {
+	return s.keys
+}
+
+// Events returns the events triggered by the REST endpoints.
+func (s *Server) Events() <-chan input.Event {
+	return s.events
+}
+
+func (s *Server) Render(pixels []byte) error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	copy(s.frame, pixels)
+
+	for c := range s.clients {
+		select {
+		case c.ready <- struct{}{}:
+		default:
+		}
+	}
+
+	return nil
+}
+
+// Shutdown stops listening and disconnects the clients.
+func (s *Server) Shutdown() {
+	s.listener.Close()
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for c := range s.clients {
+		c.ws.Close()
+	}
+}
+
+func (s *Server) handlePage(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/" {
+		http.NotFound(w, r)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Write([]byte(page))
+}
+
+// sameOrigin returns whether a request comes from the page, or from a client
+// which isn't a browser (and doesn't send an Origin header). Pages of other
+// sites can't control the emulator.
+func sameOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+
+	return err == nil && u.Host == r.Host
+}
+
+// checkOrigin rejects the WebSocket connections from other sites.
+func checkOrigin(config *websocket.Config, r *http.Request) error {
+	if !sameOrigin(r) {
+		return errors.New("Cross-origin WebSocket connection")
+	}
+
+	return nil
+}
+
+// handleWebSocket streams the frames, as PNG images by default or in the raw
+// format with "?format=raw".
+func (s *Server) handleWebSocket(ws *websocket.Conn) {
+	c := &client{
+		ws:    ws,
+		raw:   ws.Request().URL.Query().Get("format") == "raw",
+		ready: make(chan struct{}, 1),
+	}
+
+	s.mutex.Lock()
+	s.clients[c] = true
+	s.mutex.Unlock()
+
+	done := make(chan struct{})
+	go s.readKeys(c, done)
+
+	s.writeFrames(c, done)
+
+	s.mutex.Lock()
+	delete(s.clients, c)
+	s.mutex.Unlock()
+
+	ws.Close()
+}
+
+// readKeys forwards the key events sent by a client, as JSON encoded
+// input.KeyEvent, until it disconnects.
+func (s *Server) readKeys(c *client, done chan struct{}) {
+	defer close(done)
+
+	for {
+		var message []byte
+		err := websocket.Message.Receive(c.ws, &message)
+		if err != nil {
+			return
+		}
+
+		var key input.KeyEvent
+		err = json.Unmarshal(message, &key)
+		if err != nil {
+			log.Printf("Invalid key event: %s\n", err)
+			continue
+		}
+
+		s.keys <- key
+	}
+}
+
+func (s *Server) writeFrames(c *client, done chan struct{}) {
+	for {
+		select {
+		case <-c.ready:
+		case <-done:
+			return
+		}
+
+		s.mutex.Lock()
+		message, err := s.encode(c.raw)
+		s.mutex.Unlock()
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		err = websocket.Message.Send(c.ws, message)
+		if err != nil {
+			return
+		}
+	}
+}
+
+// encode encodes the last frame. Frames with more than 256 colors are sent as
+// PNG images even in the raw format, which the clients tell apart with the
+// PNG signature.
+func (s *Server) encode(raw bool) ([]byte, error) {
+	if raw {
+		message, ok := s.paletted()
+		if ok {
+			return message, nil
+		}
+	}
+
+	var buffer bytes.Buffer
+	err := png.Encode(&buffer, screen.ImageSize(s.frame, s.width, s.height))
+
+	return buffer.Bytes(), err
+}
+
+// paletted encodes the last frame in the raw format: its width and height
+// (16-bit little-endian), its number of colors minus one, its colors (as RGB
+// triplets), then the color index of each pixel.
+func (s *Server) paletted() ([]byte, bool) {
+	indexes := make(map[[3]byte]byte)
+	var colors []byte
+	pixels := make([]byte, s.width*s.height)
+
+	for i := range pixels {
+		var color [3]byte
+		copy(color[:], s.frame[i*ppu.ColorDepth:])
+
+		index, ok := indexes[color]
+		if !ok {
+			if len(indexes) == 256 {
+				return nil, false
+			}
+
+			index = byte(len(indexes))
+			indexes[color] = index
+			colors = append(colors, color[:]...)
+		}
+
+		pixels[i] = index
+	}
+
+	header := make([]byte, 5)
+	binary.LittleEndian.PutUint16(header, uint16(s.width))
+	binary.LittleEndian.PutUint16(header[2:], uint16(s.height))
+	header[4] = byte(len(indexes) - 1)
+
+	message := append(header, colors...)
+	return append(message, pixels...), true
+}
+
+func (s *Server) handleScreenshot(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	img := screen.ImageSize(s.frame, s.width, s.height)
+	s.mutex.Unlock()
+
+	w.Header().Set("Content-Type", "image/png")
+	png.Encode(w, img)
+}
+
+// handleEvent returns a handler triggering an event. The event is handled by
+// the emulator after the request is answered.
+func (s *Server) handleEvent(event input.Event) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !sameOrigin(r) {
+			http.Error(w, "Cross-origin request", http.StatusForbidden)
+			return
+		}
+
+		select {
+		case s.events <- event:
+			w.WriteHeader(http.StatusAccepted)
+		default:
+			http.Error(w, "Too many requests", http.StatusServiceUnavailable)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package sgb
+
+import (
+	"encoding/binary"
+
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// Size of the data sent by VRAM transfers, taken from the first 256 tiles
+// displayed on the screen
+const transferSize = 0x1000
+
+// runTransfer reads the data of a PAL_TRN, ATTR_TRN, CHR_TRN or PCT_TRN
+// command from the screen.
+func (s *SGB) runTransfer() {
+	data := s.screenData()
+
+	switch s.transfer &^ 0x80 {
+	case palTrn:
+		for i := range s.systemPalettes {
+			for j := range s.systemPalettes[i] {
+				s.systemPalettes[i][j] = binary.LittleEndian.Uint16(data[i*8+j*2:])
+			}
+		}
+	case attrTrn:
+		for i := range s.attributeFiles {
+			copy(s.attributeFiles[i][:], data[i*90:])
+		}
+	case chrTrn:
+		offset := 0
+		if s.transfer&0x80 == 0x80 {
+			offset = transferSize
+		}
+		copy(s.tiles[offset:offset+transferSize], data)
+	case pctTrn:
+		for i := range s.tileMap {
+			s.tileMap[i] = binary.LittleEndian.Uint16(data[i*2:])
+		}
+
+		// Palettes 4 to 7 follow the map.
+		for i := range s.borderPalettes {
+			for j := range s.borderPalettes[i] {
+				s.borderPalettes[i][j] = binary.LittleEndian.Uint16(data[0x800+i*32+j*2:])
+			}
+		}
+	}
+}
+
+// screenData converts the tiles displayed on the screen, from left to right
+// and top to bottom, back to the 2bpp format.
+func (s *SGB) screenData() []byte {
+	data := make([]byte, transferSize)
+
+	for tile := 0; tile < transferSize/16; tile++ {
+		tileX, tileY := tile%tilesWidth*8, tile/tilesWidth*8
+
+		for row := 0; row < 8; row++ {
+			var low, high byte
+			for x := 0; x < 8; x++ {
+				shade := s.ppu.Shades[(tileY+row)*ppu.ScreenWidth+tileX+x]
+				low |= shade & 1 << uint(7-x)
+				high |= shade >> 1 << uint(7-x)
+			}
+
+			data[tile*16+row*2] = low
+			data[tile*16+row*2+1] = high
+		}
+	}
+
+	return data
+}
+
+// drawBorder draws the border's 32x28 tiles. Transparent pixels show the
+// first color of the palettes.
+func (s *SGB) drawBorder() {
+	for y := 0; y < Height; y++ {
+		for x := 0; x < Width; x++ {
+			entry := s.tileMap[y/8*32+x/8]
+			tile := int(entry & 0xff)
+			palette := int(entry>>10&7) - 4
+
+			row, column := y%8, x%8
+			if entry&0x8000 != 0 {
+				row = 7 - row
+			}
+			if entry&0x4000 != 0 {
+				column = 7 - column
+			}
+
+			// Tiles are made of 4 bitplanes, interleaved by pairs.
+			offset := tile*32 + row*2
+			bit := uint(7 - column)
+			var colorNumber byte
+			for plane, address := range [4]int{offset, offset + 1, offset + 16, offset + 17} {
+				colorNumber |= s.tiles[address] >> bit & 1 << uint(plane)
+			}
+
+			color := s.palettes[0][0]
+			if colorNumber != 0 && palette >= 0 && palette < len(s.borderPalettes) {
+				color = rgb(s.borderPalettes[palette][colorNumber])
+			}
+
+			index := y*Pitch + x*ppu.ColorDepth
+			copy(s.Pixels[index:index+3], color[:])
+		}
+	}
+}
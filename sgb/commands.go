@@ -0,0 +1,252 @@
+package sgb
+
+import (
+	"encoding/binary"
+	"log"
+)
+
+// Commands, named as in the Super Game Boy documentation (e.g. attrBlk for
+// ATTR_BLK)
+const (
+	pal01 byte = iota
+	pal23
+	pal03
+	pal12
+	attrBlk
+	attrLin
+	attrDiv
+	attrChr
+	sound
+	souTrn
+	palSet
+	palTrn
+	atrcEn
+	testEn
+	iconEn
+	dataSnd
+	dataTrn
+	mltReq
+	jump
+	chrTrn
+	pctTrn
+	attrTrn
+	attrSet
+	maskEn
+	objTrn
+)
+
+func (s *SGB) execute(command byte, data []byte) {
+	switch command {
+	case pal01:
+		s.setPalettes(0, 1, data)
+	case pal23:
+		s.setPalettes(2, 3, data)
+	case pal03:
+		s.setPalettes(0, 3, data)
+	case pal12:
+		s.setPalettes(1, 2, data)
+	case attrBlk:
+		s.attributeBlocks(data)
+	case attrLin:
+		s.attributeLines(data)
+	case attrDiv:
+		s.attributeDivide(data)
+	case attrChr:
+		s.attributeCharacters(data)
+	case palSet:
+		s.setSystemPalettes(data)
+	case attrSet:
+		s.setAttributeFile(data[1])
+	case mltReq:
+		s.players = [4]byte{1, 2, 1, 4}[data[1]&3]
+		s.player = 0
+	case maskEn:
+		s.mask = data[1] & 3
+	case palTrn, attrTrn, chrTrn, pctTrn:
+		s.transfer = command
+		if command == chrTrn && data[1]&1 == 1 {
+			// Upper half of the tiles
+			s.transfer |= 0x80
+		}
+		s.transferFrames = 2
+	case sound, souTrn, atrcEn, testEn, iconEn, dataSnd, dataTrn, jump, objTrn:
+		// Unsupported, and not needed to display the games properly
+	default:
+		log.Printf("Unknown SGB command: %#x\n", command)
+	}
+}
+
+// setPalettes sets two palettes from a PALxx packet. The first color is
+// shared by all the palettes.
+func (s *SGB) setPalettes(first, second int, data []byte) {
+	color := func(i int) [3]byte {
+		return rgb(binary.LittleEndian.Uint16(data[1+i*2:]))
+	}
+
+	for i := range s.palettes {
+		s.palettes[i][0] = color(0)
+	}
+
+	for i := 1; i < 4; i++ {
+		s.palettes[first][i] = color(i)
+		s.palettes[second][i] = color(i + 3)
+	}
+}
+
+func (s *SGB) setAttribute(x, y int, palette byte) {
+	if x >= 0 && x < tilesWidth && y >= 0 && y < tilesHeight {
+		s.attributes[y*tilesWidth+x] = palette & 3
+	}
+}
+
+// attributeBlocks sets the palettes inside, on the border of and outside
+// rectangles.
+func (s *SGB) attributeBlocks(data []byte) {
+	count := int(data[1])
+
+	for i := 0; i < count && 2+i*6+6 <= len(data); i++ {
+		block := data[2+i*6:]
+		control := block[0]
+		inside := block[1] & 3
+		border := block[1] >> 2 & 3
+		outside := block[1] >> 4 & 3
+		x1, y1, x2, y2 := int(block[2]), int(block[3]), int(block[4]), int(block[5])
+
+		// The border takes the palette of the only area changed.
+		switch control & 7 {
+		case 1:
+			border = inside
+			control |= 2
+		case 4:
+			border = outside
+			control |= 2
+		}
+
+		for y := 0; y < tilesHeight; y++ {
+			for x := 0; x < tilesWidth; x++ {
+				isInside := x > x1 && x < x2 && y > y1 && y < y2
+				isOutside := x < x1 || x > x2 || y < y1 || y > y2
+
+				switch {
+				case isInside && control&1 == 1:
+					s.setAttribute(x, y, inside)
+				case isOutside && control&4 == 4:
+					s.setAttribute(x, y, outside)
+				case !isInside && !isOutside && control&2 == 2:
+					s.setAttribute(x, y, border)
+				}
+			}
+		}
+	}
+}
+
+// attributeLines sets the palettes of whole rows or columns.
+func (s *SGB) attributeLines(data []byte) {
+	count := int(data[1])
+
+	for i := 0; i < count && 2+i < len(data); i++ {
+		line := data[2+i]
+		number := int(line & 0x1f)
+		palette := line >> 5 & 3
+
+		if line&0x80 == 0x80 {
+			for x := 0; x < tilesWidth; x++ {
+				s.setAttribute(x, number, palette)
+			}
+		} else {
+			for y := 0; y < tilesHeight; y++ {
+				s.setAttribute(number, y, palette)
+			}
+		}
+	}
+}
+
+// attributeDivide splits the screen in two along a row or a column.
+func (s *SGB) attributeDivide(data []byte) {
+	after := data[1] & 3
+	before := data[1] >> 2 & 3
+	on := data[1] >> 4 & 3
+	horizontal := data[1]&0x40 == 0x40
+	line := int(data[2])
+
+	for y := 0; y < tilesHeight; y++ {
+		for x := 0; x < tilesWidth; x++ {
+			position := x
+			if horizontal {
+				position = y
+			}
+
+			switch {
+			case position < line:
+				s.setAttribute(x, y, before)
+			case position == line:
+				s.setAttribute(x, y, on)
+			default:
+				s.setAttribute(x, y, after)
+			}
+		}
+	}
+}
+
+// attributeCharacters sets the palettes of consecutive tiles, four per byte
+// from the highest bits.
+func (s *SGB) attributeCharacters(data []byte) {
+	x, y := int(data[1]), int(data[2])
+	count := int(binary.LittleEndian.Uint16(data[3:]))
+	vertical := data[5] == 1
+
+	for i := 0; i < count && 6+i/4 < len(data); i++ {
+		palette := data[6+i/4] >> uint(6-i%4*2)
+		s.setAttribute(x, y, palette)
+
+		if vertical {
+			y++
+			if y >= tilesHeight {
+				y = 0
+				x++
+			}
+		} else {
+			x++
+			if x >= tilesWidth {
+				x = 0
+				y++
+			}
+		}
+	}
+}
+
+// setSystemPalettes sets the four palettes from the ones sent with PAL_TRN,
+// optionally applying an attribute file.
+func (s *SGB) setSystemPalettes(data []byte) {
+	for i := range s.palettes {
+		number := binary.LittleEndian.Uint16(data[1+i*2:]) & 0x1ff
+		for j, color := range s.systemPalettes[number] {
+			s.palettes[i][j] = rgb(color)
+		}
+	}
+
+	// The first color is shared.
+	for i := range s.palettes {
+		s.palettes[i][0] = s.palettes[0][0]
+	}
+
+	if data[9]&0x80 == 0x80 {
+		s.setAttributeFile(data[9])
+	}
+}
+
+// setAttributeFile applies one of the attribute files sent with ATTR_TRN,
+// and cancels the mask if asked to.
+func (s *SGB) setAttributeFile(value byte) {
+	number := int(value & 0x3f)
+	if number < len(s.attributeFiles) {
+		file := s.attributeFiles[number]
+		for i := range s.attributes {
+			s.attributes[i] = file[i/4] >> uint(6-i%4*2) & 3
+		}
+	}
+
+	if value&0x40 == 0x40 {
+		s.mask = maskCancel
+	}
+}
@@ -0,0 +1,301 @@
+package sgb
+
+import (
+	"encoding/binary"
+	"io"
+
+	"github.com/bovarysme/bmo/cartridge"
+	"github.com/bovarysme/bmo/palette"
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// Size of the frame, border included
+const (
+	Width  = 256
+	Height = 224
+	Pitch  = Width * ppu.ColorDepth
+)
+
+// Position of the Game Boy screen within the border
+const (
+	screenX = (Width - ppu.ScreenWidth) / 2
+	screenY = (Height - ppu.ScreenHeight) / 2
+)
+
+// Size of the screen in tiles, which attributes are given for
+const (
+	tilesWidth  = ppu.ScreenWidth / 8
+	tilesHeight = ppu.ScreenHeight / 8
+)
+
+// MASK_EN modes
+const (
+	maskCancel byte = iota
+	maskFreeze
+	maskBlack
+	maskColor0
+)
+
+// Supported returns whether a game uses the Super Game Boy functions.
+func Supported(header *cartridge.Header) bool {
+	return header.SGBFlag == 0x03 && header.OldLicenseeCode == 0x33
+}
+
+// SGB colorizes the Game Boy screen and draws a border around it, as
+// instructed by the command packets sent by the game through P1.
+type SGB struct {
+	// Bordered frame
+	Pixels []byte
+	// Colorized Game Boy screen, laid out like the PPU's pixels
+	Screen []byte
+
+	ppu *ppu.PPU
+
+	// Packet transfer state
+	p1        byte
+	receiving bool
+	bits      int
+	packet    [16]byte
+	data      []byte
+	// Number of packets of the command being received
+	packets int
+
+	palettes   [4]ppu.Palette
+	attributes [tilesWidth * tilesHeight]byte
+	mask       byte
+
+	// Palettes and attribute files sent with PAL_TRN and ATTR_TRN
+	systemPalettes [512][4]uint16
+	attributeFiles [45][90]byte
+
+	// Border tiles (in the SNES 4bpp format), map and palettes
+	tiles          [256 * 32]byte
+	tileMap        [32 * 32]uint16
+	borderPalettes [4][16]uint16
+
+	// VRAM transfer to run once the data has been displayed for a frame
+	transfer       byte
+	transferFrames int
+
+	// Number of joypads (1, 2 or 4) and selected one
+	players byte
+	player  byte
+}
+
+func NewSGB(p *ppu.PPU) *SGB {
+	s := &SGB{
+		Pixels: make([]byte, Width*Height*ppu.ColorDepth),
+		Screen: make([]byte, len(p.Pixels)),
+
+		ppu: p,
+
+		p1:      0x30,
+		players: 1,
+	}
+
+	for i := range s.palettes {
+		s.palettes[i] = palette.SGB
+	}
+
+	return s
+}
+
+// WriteP1 receives the packets' bits: a pulse on P14 is a 0, one on P15 a 1,
+// and one on both resets the transfer. A transfer is 16 bytes sent from the
+// lowest bit, followed by a 0.
+func (s *SGB) WriteP1(value byte) {
+	previous := s.p1
+	s.p1 = value
+
+	// Selecting the next joypad
+	if previous&0x20 == 0 && value&0x20 != 0 && s.players > 1 {
+		s.player = (s.player + 1) % s.players
+	}
+
+	if previous != 0x30 {
+		return
+	}
+
+	switch value {
+	case 0x00:
+		s.receiving = true
+		s.bits = 0
+		s.packet = [16]byte{}
+	case 0x10, 0x20:
+		if s.receiving {
+			s.receiveBit(value == 0x10)
+		}
+	}
+}
+
+func (s *SGB) receiveBit(bit bool) {
+	if s.bits == len(s.packet)*8 {
+		// Stop bit
+		s.receiving = false
+		if !bit {
+			s.receivePacket()
+		}
+
+		return
+	}
+
+	if bit {
+		s.packet[s.bits/8] |= 1 << uint(s.bits%8)
+	}
+	s.bits++
+}
+
+func (s *SGB) receivePacket() {
+	if len(s.data) == 0 {
+		s.packets = int(s.packet[0] & 7)
+		if s.packets == 0 {
+			return
+		}
+	}
+
+	s.data = append(s.data, s.packet[:]...)
+	if len(s.data) < s.packets*len(s.packet) {
+		return
+	}
+
+	s.execute(s.data[0]>>3, s.data)
+	s.data = s.data[:0]
+}
+
+func (s *SGB) Player() byte {
+	return s.player
+}
+
+// Render colorizes the last frame and draws it within the border. It also
+// runs the pending VRAM transfer.
+func (s *SGB) Render() {
+	if s.transferFrames > 0 {
+		s.transferFrames--
+		if s.transferFrames == 0 {
+			s.runTransfer()
+		}
+	}
+
+	switch s.mask {
+	case maskCancel:
+		s.colorize()
+	case maskBlack:
+		s.fill(ppu.Palette{})
+	case maskColor0:
+		s.fill(s.palettes[0])
+	}
+
+	s.drawBorder()
+
+	for y := 0; y < ppu.ScreenHeight; y++ {
+		src := y * ppu.Pitch
+		dst := (screenY+y)*Pitch + screenX*ppu.ColorDepth
+		copy(s.Pixels[dst:dst+ppu.Pitch], s.Screen[src:src+ppu.Pitch])
+	}
+}
+
+func (s *SGB) colorize() {
+	for y := 0; y < ppu.ScreenHeight; y++ {
+		for x := 0; x < ppu.ScreenWidth; x++ {
+			palette := s.attributes[y/8*tilesWidth+x/8]
+			shade := s.ppu.Shades[y*ppu.ScreenWidth+x]
+			color := s.palettes[palette][shade]
+
+			index := y*ppu.Pitch + x*ppu.ColorDepth
+			copy(s.Screen[index:index+3], color[:])
+		}
+	}
+}
+
+// fill fills the screen with the first color of a palette.
+func (s *SGB) fill(palette ppu.Palette) {
+	for i := 0; i < len(s.Screen); i += ppu.ColorDepth {
+		copy(s.Screen[i:i+3], palette[0][:])
+	}
+}
+
+// rgb converts a 15-bit SNES color.
+func rgb(color uint16) [3]byte {
+	var c [3]byte
+	for i := range c {
+		v := byte(color>>(uint(i)*5)) & 0x1f
+		c[i] = v<<3 | v>>2
+	}
+
+	return c
+}
+
+type sgbState struct {
+	Palettes   [4]ppu.Palette
+	Attributes [tilesWidth * tilesHeight]byte
+	Mask       byte
+
+	SystemPalettes [512][4]uint16
+	AttributeFiles [45][90]byte
+
+	Tiles          [256 * 32]byte
+	TileMap        [32 * 32]uint16
+	BorderPalettes [4][16]uint16
+
+	Transfer       byte
+	TransferFrames int32
+
+	Players byte
+	Player  byte
+}
+
+// SaveState saves the colors, the border and the joypads' state. Packets
+// being received aren't saved.
+func (s *SGB) SaveState(w io.Writer) error {
+	state := sgbState{
+		Palettes:   s.palettes,
+		Attributes: s.attributes,
+		Mask:       s.mask,
+
+		SystemPalettes: s.systemPalettes,
+		AttributeFiles: s.attributeFiles,
+
+		Tiles:          s.tiles,
+		TileMap:        s.tileMap,
+		BorderPalettes: s.borderPalettes,
+
+		Transfer:       s.transfer,
+		TransferFrames: int32(s.transferFrames),
+
+		Players: s.players,
+		Player:  s.player,
+	}
+
+	return binary.Write(w, binary.LittleEndian, &state)
+}
+
+func (s *SGB) LoadState(r io.Reader) error {
+	var state sgbState
+
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
+	}
+
+	s.palettes = state.Palettes
+	s.attributes = state.Attributes
+	s.mask = state.Mask
+
+	s.systemPalettes = state.SystemPalettes
+	s.attributeFiles = state.AttributeFiles
+
+	s.tiles = state.Tiles
+	s.tileMap = state.TileMap
+	s.borderPalettes = state.BorderPalettes
+
+	s.transfer = state.Transfer
+	s.transferFrames = int(state.TransferFrames)
+
+	s.players = state.Players
+	s.player = state.Player
+
+	s.receiving = false
+	s.data = s.data[:0]
+
+	return nil
+}
@@ -1,6 +1,9 @@
 package timer
 
 import (
+	"encoding/binary"
+	"io"
+
 	"github.com/bovarysme/bmo/interrupt"
 )
 
@@ -17,17 +20,18 @@ const (
 	TimerStart       byte = 1 << 2
 )
 
-var freqs = [4]int{256, 4, 16, 64}
+// Bit of the internal counter whose falling edge increments TIMA, for each
+// input clock
+var counterBits = [4]uint{9, 3, 5, 7}
 
 type Timer struct {
 	ic *interrupt.IC
 
-	div  byte
-	tima byte
-	tma  byte
-	tac  byte
-
-	cycles int
+	// Internal counter, incremented every clock cycle. DIV is its upper byte.
+	counter uint16
+	tima    byte
+	tma     byte
+	tac     byte
 }
 
 func NewTimer(ic *interrupt.IC) *Timer {
@@ -36,12 +40,17 @@ func NewTimer(ic *interrupt.IC) *Timer {
 	}
 }
 
+// SkipBoot sets the internal counter to the value left by the boot ROM.
+func (t *Timer) SkipBoot(counter uint16) {
+	t.counter = counter
+}
+
 func (t *Timer) ReadByte(address uint16) byte {
 	var value byte
 
 	switch address {
 	case DIV:
-		value = t.div
+		value = byte(t.counter >> 8)
 	case TIMA:
 		value = t.tima
 	case TMA:
@@ -53,10 +62,15 @@ func (t *Timer) ReadByte(address uint16) byte {
 	return value
 }
 
+// WriteByte writes to the timer's registers. Resetting the counter or
+// changing the input clock can bring the selected bit low, which increments
+// TIMA.
 func (t *Timer) WriteByte(address uint16, value byte) {
+	signal := t.signal()
+
 	switch address {
 	case DIV:
-		t.div = value
+		t.counter = 0
 	case TIMA:
 		t.tima = value
 	case TMA:
@@ -64,26 +78,72 @@ func (t *Timer) WriteByte(address uint16, value byte) {
 	case TAC:
 		t.tac = value
 	}
+
+	if signal && !t.signal() {
+		t.increment()
+	}
 }
 
 func (t *Timer) Step(cycles int) {
+	for i := 0; i < cycles; i++ {
+		signal := t.signal()
+
+		t.counter += 4
+
+		if signal && !t.signal() {
+			t.increment()
+		}
+	}
+}
+
+// signal returns whether the timer is enabled and the counter's bit selected
+// by the input clock is set.
+func (t *Timer) signal() bool {
 	enabled := t.tac&TimerStart == TimerStart
-	if !enabled {
-		return
+	bit := counterBits[t.tac&InputClockSelect]
+
+	return enabled && t.counter>>bit&1 == 1
+}
+
+func (t *Timer) increment() {
+	t.tima++
+	if t.tima == 0 {
+		t.tima = t.tma
+
+		t.ic.Request(interrupt.Timer)
 	}
+}
+
+type timerState struct {
+	Counter uint16
+	TIMA    byte
+	TMA     byte
+	TAC     byte
+}
 
-	inputClock := t.tac & InputClockSelect
-	freq := freqs[inputClock]
+func (t *Timer) SaveState(w io.Writer) error {
+	state := timerState{
+		Counter: t.counter,
+		TIMA:    t.tima,
+		TMA:     t.tma,
+		TAC:     t.tac,
+	}
 
-	t.cycles += cycles
-	if t.cycles >= freq {
-		t.cycles -= freq
+	return binary.Write(w, binary.LittleEndian, &state)
+}
 
-		t.tima++
-		if t.tima == 0 {
-			t.tima = t.tma
+func (t *Timer) LoadState(r io.Reader) error {
+	var state timerState
 
-			t.ic.Request(interrupt.Timer)
-		}
+	err := binary.Read(r, binary.LittleEndian, &state)
+	if err != nil {
+		return err
 	}
+
+	t.counter = state.Counter
+	t.tima = state.TIMA
+	t.tma = state.TMA
+	t.tac = state.TAC
+
+	return nil
 }
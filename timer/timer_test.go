@@ -0,0 +1,52 @@
+package timer
+
+import (
+	"testing"
+
+	"github.com/bovarysme/bmo/interrupt"
+)
+
+func TestWriteFallingEdge(t *testing.T) {
+	tests := []struct {
+		name    string
+		counter uint16
+		tac     byte
+		tima    byte
+		address uint16
+		value   byte
+
+		wantTIMA      byte
+		wantInterrupt bool
+	}{
+		{"DIV write with the selected bit set", 0x0008, 0x05, 0x10, DIV, 0, 0x11, false},
+		{"DIV write with the selected bit clear", 0x0004, 0x05, 0x10, DIV, 0, 0x10, false},
+		{"DIV write with the timer stopped", 0x0008, 0x01, 0x10, DIV, 0, 0x10, false},
+		{"DIV write at 4096 Hz", 0x0200, 0x04, 0x10, DIV, 0, 0x11, false},
+		{"DIV write overflowing TIMA", 0x0008, 0x05, 0xff, DIV, 0, 0x42, true},
+		{"TAC write stopping the timer", 0x0008, 0x05, 0x10, TAC, 0x01, 0x11, false},
+		{"TAC write selecting a clear bit", 0x0008, 0x05, 0x10, TAC, 0x06, 0x11, false},
+		{"TAC write selecting a set bit", 0x0208, 0x05, 0x10, TAC, 0x04, 0x10, false},
+	}
+
+	for _, test := range tests {
+		ic := interrupt.NewIC()
+		ic.WriteByte(interrupt.IE, interrupt.Timer)
+
+		timer := NewTimer(ic)
+		timer.counter = test.counter
+		timer.tac = test.tac
+		timer.tima = test.tima
+		timer.tma = 0x42
+
+		timer.WriteByte(test.address, test.value)
+
+		if timer.tima != test.wantTIMA {
+			t.Errorf("%s: TIMA is %#02x, want %#02x", test.name, timer.tima, test.wantTIMA)
+		}
+
+		interrupted, _ := ic.Check()
+		if interrupted != test.wantInterrupt {
+			t.Errorf("%s: timer interrupt requested: %t, want %t", test.name, interrupted, test.wantInterrupt)
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package video
+
+import (
+	"bytes"
+	"compress/lzw"
+	"encoding/binary"
+	"image/color"
+	"log"
+
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// Browsers slow down GIFs with delays shorter than 2 hundredths of a second,
+// so only every other frame is kept.
+const (
+	frameSkip = 2
+	// Hundredths of a second per frame
+	frameDelay = 100 * 70224 / 4194304.0
+)
+
+// Minimum LZW code size, the palette's 4 colors taking 2 bits
+const lzwWidth = 2
+
+// Maximum size of the GIF data sub-blocks
+const blockSize = 255
+
+// GIFRecorder streams frames to an animated GIF. Its palette is made of the
+// four DMG shades, as colored by the background palette, other colors (e.g.
+// of the Super Game Boy) being mapped to the nearest shade.
+type GIFRecorder struct {
+	path   string
+	output *output
+
+	palette color.Palette
+	indexes map[color.RGBA]uint8
+	// Palette indexes of the current frame's pixels
+	indexed []byte
+	buffer  bytes.Buffer
+
+	frames int
+	// Time elapsed since the start of the recording, in hundredths of a
+	// second
+	elapsed float64
+	written int
+	saved   int
+}
+
+func NewGIFRecorder(path string, shades ppu.Palette) (*GIFRecorder, error) {
+	output, err := create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	g := &GIFRecorder{
+		path:    path,
+		output:  output,
+		indexes: make(map[color.RGBA]uint8),
+		indexed: make([]byte, ppu.ScreenWidth*ppu.ScreenHeight),
+	}
+
+	for _, c := range shades {
+		g.palette = append(g.palette, color.RGBA{c[0], c[1], c[2], 0xff})
+	}
+
+	err = g.writeHeader()
+	if err != nil {
+		output.Close()
+		return nil, err
+	}
+
+	return g, nil
+}
+
+// writeHeader writes the GIF header, the global palette and the extension
+// looping the animation.
+func (g *GIFRecorder) writeHeader() error {
+	g.buffer.Reset()
+	g.buffer.WriteString("GIF89a")
+
+	// Logical screen descriptor, with a global palette of 2^(1+1) colors
+	binary.Write(&g.buffer, binary.LittleEndian, [2]uint16{ppu.ScreenWidth, ppu.ScreenHeight})
+	g.buffer.Write([]byte{0xf1, 0x00, 0x00})
+
+	for _, c := range g.palette {
+		r, gr, b, _ := c.RGBA()
+		g.buffer.Write([]byte{byte(r >> 8), byte(gr >> 8), byte(b >> 8)})
+	}
+
+	g.buffer.Write([]byte{0x21, 0xff, 0x0b})
+	g.buffer.WriteString("NETSCAPE2.0")
+	g.buffer.Write([]byte{0x03, 0x01, 0x00, 0x00, 0x00})
+
+	_, err := g.output.Write(g.buffer.Bytes())
+
+	return err
+}
+
+func (g *GIFRecorder) Record(pixels []byte) error {
+	g.frames++
+	g.elapsed += frameDelay
+
+	if g.frames%frameSkip != 0 {
+		return nil
+	}
+
+	for i := range g.indexed {
+		j := i * ppu.ColorDepth
+		g.indexed[i] = g.index(color.RGBA{pixels[j], pixels[j+1], pixels[j+2], 0xff})
+	}
+
+	// Round the delays so that the animation doesn't drift.
+	delay := int(g.elapsed+0.5) - g.written
+	g.written += delay
+
+	g.buffer.Reset()
+
+	// Graphic control extension, holding the frame's delay
+	g.buffer.Write([]byte{0x21, 0xf9, 0x04, 0x00, byte(delay), byte(delay >> 8), 0x00, 0x00})
+
+	// Image descriptor, for a full frame using the global palette
+	g.buffer.WriteByte(0x2c)
+	binary.Write(&g.buffer, binary.LittleEndian, [4]uint16{0, 0, ppu.ScreenWidth, ppu.ScreenHeight})
+	g.buffer.WriteByte(0x00)
+
+	err := g.writeImageData()
+	if err != nil {
+		return err
+	}
+
+	_, err = g.output.Write(g.buffer.Bytes())
+	if err != nil {
+		return err
+	}
+
+	g.saved++
+
+	return nil
+}
+
+// writeImageData compresses the frame's indexes into the buffer, split into
+// sub-blocks.
+func (g *GIFRecorder) writeImageData() error {
+	var data bytes.Buffer
+
+	writer := lzw.NewWriter(&data, lzw.LSB, lzwWidth)
+	_, err := writer.Write(g.indexed)
+	if err != nil {
+		return err
+	}
+
+	err = writer.Close()
+	if err != nil {
+		return err
+	}
+
+	g.buffer.WriteByte(lzwWidth)
+
+	for data.Len() > 0 {
+		block := data.Next(blockSize)
+		g.buffer.WriteByte(byte(len(block)))
+		g.buffer.Write(block)
+	}
+
+	g.buffer.WriteByte(0x00)
+
+	return nil
+}
+
+// Close ends the GIF.
+func (g *GIFRecorder) Close() error {
+	err := g.output.WriteByte(0x3b)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Saved %d frames GIF to '%s'\n", g.saved, g.path)
+
+	return g.output.Close()
+}
+
+// index returns the palette index of the shade nearest to a color.
+func (g *GIFRecorder) index(c color.RGBA) uint8 {
+	index, ok := g.indexes[c]
+	if ok {
+		return index
+	}
+
+	index = uint8(g.palette.Index(c))
+	g.indexes[c] = index
+
+	return index
+}
@@ -0,0 +1,96 @@
+package video
+
+import (
+	"fmt"
+	"image/color"
+
+	"github.com/bovarysme/bmo/ppu"
+)
+
+// Y4MRecorder streams frames in the YUV4MPEG2 format (with 4:4:4 chroma
+// sampling), which ffmpeg reads directly:
+//
+//	bmo -rom game.gb -y4m - | ffmpeg -i - game.mp4
+type Y4MRecorder struct {
+	output *output
+	planes [3][ppu.ScreenWidth * ppu.ScreenHeight]byte
+}
+
+func NewY4MRecorder(path string) (*Y4MRecorder, error) {
+	output, err := create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	// The frame rate is given as the number of dots per second over the
+	// number of dots per frame.
+	_, err = fmt.Fprintf(output, "YUV4MPEG2 W%d H%d F4194304:70224 Ip A1:1 C444\n",
+		ppu.ScreenWidth, ppu.ScreenHeight)
+	if err != nil {
+		output.Close()
+		return nil, err
+	}
+
+	return &Y4MRecorder{
+		output: output,
+	}, nil
+}
+
+func (y *Y4MRecorder) Record(pixels []byte) error {
+	for i := range y.planes[0] {
+		j := i * ppu.ColorDepth
+		y.planes[0][i], y.planes[1][i], y.planes[2][i] = color.RGBToYCbCr(pixels[j], pixels[j+1], pixels[j+2])
+	}
+
+	_, err := y.output.WriteString("FRAME\n")
+	if err != nil {
+		return err
+	}
+
+	for _, plane := range y.planes {
+		_, err = y.output.Write(plane[:])
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (y *Y4MRecorder) Close() error {
+	return y.output.Close()
+}
+
+// RawRecorder streams frames as raw RGB24 pixels, which ffmpeg reads with:
+//
+//	ffmpeg -f rawvideo -pixel_format rgb24 -video_size 160x144 \
+//		-framerate 4194304/70224 -i - game.mp4
+type RawRecorder struct {
+	output *output
+	frame  [ppu.ScreenWidth * ppu.ScreenHeight * 3]byte
+}
+
+func NewRawRecorder(path string) (*RawRecorder, error) {
+	output, err := create(path)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RawRecorder{
+		output: output,
+	}, nil
+}
+
+func (r *RawRecorder) Record(pixels []byte) error {
+	for i := 0; i < ppu.ScreenWidth*ppu.ScreenHeight; i++ {
+		copy(r.frame[i*3:i*3+3], pixels[i*ppu.ColorDepth:])
+	}
+
+	_, err := r.output.Write(r.frame[:])
+
+	return err
+}
+
+func (r *RawRecorder) Close() error {
+	return r.output.Close()
+}
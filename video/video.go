@@ -0,0 +1,52 @@
+package video
+
+import (
+	"bufio"
+	"os"
+)
+
+// Recorder writes emitted frames to a video.
+type Recorder interface {
+	Record(pixels []byte) error
+	Close() error
+}
+
+// output is a buffered file, or the standard output if its path is "-" (e.g.
+// to pipe frames to ffmpeg).
+type output struct {
+	*bufio.Writer
+	file *os.File
+}
+
+func create(path string) (*output, error) {
+	file := os.Stdout
+	if path != "-" {
+		var err error
+
+		file, err = os.Create(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return &output{
+		Writer: bufio.NewWriter(file),
+		file:   file,
+	}, nil
+}
+
+// Close flushes the output and closes its file, even if flushing fails.
+func (o *output) Close() error {
+	err := o.Flush()
+
+	if o.file == os.Stdout {
+		return err
+	}
+
+	closeErr := o.file.Close()
+	if err != nil {
+		return err
+	}
+
+	return closeErr
+}
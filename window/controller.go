@@ -0,0 +1,145 @@
+package window
+
+import (
+	"log"
+
+	"github.com/bovarysme/bmo/input"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Stick positions within the deadzone are ignored.
+const deadzone = 8000
+
+// handleDevice opens controllers when they're plugged in (SDL also reports
+// the controllers plugged in at startup), and closes them when they're
+// unplugged.
+func (k *Keys) handleDevice(event *sdl.ControllerDeviceEvent) {
+	switch event.Type {
+	case sdl.CONTROLLERDEVICEADDED:
+		// Which is the device index here, and the instance ID otherwise.
+		controller := sdl.GameControllerOpen(int(event.Which))
+		if controller == nil {
+			log.Printf("Couldn't open controller: %s\n", sdl.GetError())
+			return
+		}
+
+		id := controller.Joystick().InstanceID()
+		k.controllers[id] = controller
+		log.Printf("Controller connected: %s\n", controller.Name())
+	case sdl.CONTROLLERDEVICEREMOVED:
+		controller, ok := k.controllers[event.Which]
+		if !ok {
+			return
+		}
+
+		log.Printf("Controller disconnected: %s\n", controller.Name())
+		controller.Close()
+		delete(k.controllers, event.Which)
+	}
+}
+
+func (k *Keys) handleButton(event *sdl.ControllerButtonEvent) input.Event {
+	pressed := event.State == sdl.PRESSED
+
+	// The shoulder buttons are bound to the rewind and fast-forward
+	// hotkeys.
+	switch event.Button {
+	case sdl.CONTROLLER_BUTTON_LEFTSHOULDER:
+		if pressed {
+			return input.RewindPressed
+		}
+		return input.RewindReleased
+	case sdl.CONTROLLER_BUTTON_RIGHTSHOULDER:
+		if pressed {
+			return input.FastForwardPressed
+		}
+		return input.FastForwardReleased
+	}
+
+	key, ok := k.getButton(event.Button)
+	if !ok {
+		return input.None
+	}
+
+	if pressed {
+		k.joypad.SetKey(key)
+	} else {
+		k.joypad.ResetKey(key)
+	}
+
+	return input.None
+}
+
+// handleAxis maps the left stick to the directions, pressing and releasing
+// them as the stick enters and leaves the deadzone.
+func (k *Keys) handleAxis(event *sdl.ControllerAxisEvent) {
+	var axis int
+	var negative, positive byte
+
+	switch event.Axis {
+	case sdl.CONTROLLER_AXIS_LEFTX:
+		axis, negative, positive = 0, input.Left, input.Right
+	case sdl.CONTROLLER_AXIS_LEFTY:
+		axis, negative, positive = 1, input.Up, input.Down
+	default:
+		return
+	}
+
+	direction := 0
+	if event.Value < -deadzone {
+		direction = -1
+	} else if event.Value > deadzone {
+		direction = 1
+	}
+
+	if direction == k.stick[axis] {
+		return
+	}
+
+	switch k.stick[axis] {
+	case -1:
+		k.joypad.ResetKey(negative)
+	case 1:
+		k.joypad.ResetKey(positive)
+	}
+
+	switch direction {
+	case -1:
+		k.joypad.SetKey(negative)
+	case 1:
+		k.joypad.SetKey(positive)
+	}
+
+	k.stick[axis] = direction
+}
+
+// getButton maps the controller buttons to the joypad keys. The face buttons
+// are mapped by position: the right one is A and the bottom one is B.
+func (k *Keys) getButton(button uint8) (byte, bool) {
+	var value byte
+	var ok bool = true
+
+	switch button {
+	case sdl.CONTROLLER_BUTTON_DPAD_RIGHT:
+		value = input.Right
+	case sdl.CONTROLLER_BUTTON_DPAD_LEFT:
+		value = input.Left
+	case sdl.CONTROLLER_BUTTON_DPAD_UP:
+		value = input.Up
+	case sdl.CONTROLLER_BUTTON_DPAD_DOWN:
+		value = input.Down
+	case sdl.CONTROLLER_BUTTON_B:
+		value = input.A
+	case sdl.CONTROLLER_BUTTON_A:
+		value = input.B
+	case sdl.CONTROLLER_BUTTON_BACK:
+		value = input.Select
+	case sdl.CONTROLLER_BUTTON_START:
+		value = input.Start
+	default:
+		ok = false
+	}
+
+	return value, ok
+}
@@ -0,0 +1,62 @@
+package window
+
+import (
+	"github.com/bovarysme/bmo/input"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+// Keys reads the keys pressed in the window and the game controllers.
+type Keys struct {
+	joypad   *input.Joypad
+	bindings input.Bindings
+
+	controllers map[sdl.JoystickID]*sdl.GameController
+	// Direction of the left stick on each axis (-1, 0 or 1)
+	stick [2]int
+}
+
+func NewKeys(joypad *input.Joypad, bindings input.Bindings) *Keys {
+	return &Keys{
+		joypad:   joypad,
+		bindings: bindings,
+
+		controllers: make(map[sdl.JoystickID]*sdl.GameController),
+	}
+}
+
+func (k *Keys) Read() input.Event {
+	for {
+		event := sdl.PollEvent()
+		if event == nil {
+			break
+		}
+
+		switch t := event.(type) {
+		case *sdl.QuitEvent:
+			return input.Quit
+		case *sdl.KeyDownEvent:
+			name := sdl.GetKeyName(t.Keysym.Sym)
+			event := k.bindings.Press(k.joypad, name, t.Repeat != 0)
+			if event != input.None {
+				return event
+			}
+		case *sdl.KeyUpEvent:
+			event := k.bindings.Release(k.joypad, sdl.GetKeyName(t.Keysym.Sym))
+			if event != input.None {
+				return event
+			}
+		case *sdl.ControllerDeviceEvent:
+			k.handleDevice(t)
+		case *sdl.ControllerButtonEvent:
+			event := k.handleButton(t)
+			if event != input.None {
+				return event
+			}
+		case *sdl.ControllerAxisEvent:
+			k.handleAxis(t)
+		}
+	}
+
+	return input.None
+}
@@ -0,0 +1,160 @@
+package window
+
+import (
+	"github.com/bovarysme/bmo/ppu"
+	"github.com/bovarysme/bmo/screen"
+
+	"github.com/veandco/go-sdl2/sdl"
+)
+
+type Screen struct {
+	window   *sdl.Window
+	renderer *sdl.Renderer
+	texture  *sdl.Texture
+
+	width      int
+	height     int
+	fullscreen bool
+
+	filter *screen.Filter
+}
+
+// NewScreen opens a resizable window displaying frames of the given size
+// (e.g. the Super Game Boy's bordered frames). Frames are scaled by integer
+// factors and keep their aspect ratio.
+func NewScreen(width, height int, options screen.Options) (*Screen, error) {
+	f, err := screen.NewFilter(width, height, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Game controllers are initialized here as well, since SDL has to be
+	// initialized once for both the screen and the keys.
+	err = sdl.Init(sdl.INIT_VIDEO | sdl.INIT_GAMECONTROLLER)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &Screen{
+		width:  width,
+		height: height,
+
+		filter: f,
+	}
+
+	window, err := sdl.CreateWindow("BMO", sdl.WINDOWPOS_UNDEFINED, sdl.WINDOWPOS_UNDEFINED,
+		width*options.Scale, height*options.Scale, sdl.WINDOW_SHOWN|sdl.WINDOW_RESIZABLE)
+	if err != nil {
+		s.Shutdown()
+		return nil, err
+	}
+	s.window = window
+
+	renderer, err := sdl.CreateRenderer(window, -1, sdl.RENDERER_ACCELERATED)
+	if err != nil {
+		s.Shutdown()
+		return nil, err
+	}
+	s.renderer = renderer
+
+	// The renderer letterboxes the frames and scales them by the largest
+	// integer factor fitting in the window.
+	err = renderer.SetLogicalSize(width, height)
+	if err != nil {
+		s.Shutdown()
+		return nil, err
+	}
+
+	err = renderer.SetIntegerScale(true)
+	if err != nil {
+		s.Shutdown()
+		return nil, err
+	}
+
+	// The pixels are stored as R, G, B and padding bytes, which is the
+	// BGR888 format on little-endian machines.
+	texture, err := renderer.CreateTexture(sdl.PIXELFORMAT_BGR888, sdl.TEXTUREACCESS_STREAMING,
+		width*f.Scale(), height*f.Scale())
+	if err != nil {
+		s.Shutdown()
+		return nil, err
+	}
+	s.texture = texture
+
+	if options.Fullscreen {
+		err = s.ToggleFullscreen()
+		if err != nil {
+			s.Shutdown()
+			return nil, err
+		}
+	}
+
+	err = renderer.Clear()
+	if err != nil {
+		s.Shutdown()
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (s *Screen) Render(pixels []byte) error {
+	pixels = s.filter.Apply(pixels)
+
+	err := s.texture.Update(nil, pixels, s.width*s.filter.Scale()*ppu.ColorDepth)
+	if err != nil {
+		s.Shutdown()
+		return err
+	}
+
+	// Clearing the letterboxing bars
+	err = s.renderer.Clear()
+	if err != nil {
+		s.Shutdown()
+		return err
+	}
+
+	err = s.renderer.Copy(s.texture, nil, nil)
+	if err != nil {
+		s.Shutdown()
+		return err
+	}
+
+	s.renderer.Present()
+
+	return nil
+}
+
+// ToggleFullscreen switches between the window and a borderless fullscreen
+// window at the desktop's resolution.
+func (s *Screen) ToggleFullscreen() error {
+	var flags uint32
+	if !s.fullscreen {
+		flags = sdl.WINDOW_FULLSCREEN_DESKTOP
+	}
+
+	err := s.window.SetFullscreen(flags)
+	if err != nil {
+		return err
+	}
+
+	s.fullscreen = !s.fullscreen
+
+	return nil
+}
+
+func (s *Screen) Shutdown() {
+	if s.texture != nil {
+		s.texture.Destroy()
+	}
+
+	if s.renderer != nil {
+		s.renderer.Destroy()
+	}
+
+	if s.window != nil {
+		s.window.Destroy()
+	}
+
+	sdl.Quit()
+}
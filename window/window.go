@@ -0,0 +1,18 @@
+package window
+
+import (
+	"github.com/bovarysme/bmo/input"
+	"github.com/bovarysme/bmo/screen"
+)
+
+// Window displays the emulator in an SDL window, and reads the keys and the
+// game controllers from it.
+type Window struct{}
+
+func (w Window) Open(width, height int, options screen.Options) (screen.Screen, error) {
+	return NewScreen(width, height, options)
+}
+
+func (w Window) Keys(joypad *input.Joypad, bindings input.Bindings) input.Keys {
+	return NewKeys(joypad, bindings)
+}